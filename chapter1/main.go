@@ -8,15 +8,14 @@ import (
 	"time"
 )
 
-const num_items = 20 // A reasonable value for exhaustive search.
+const num_items = 20            // A reasonable value for exhaustive search.
+const max_exhaustive_items = 25 // Most items exhaustive search runs on.
 
 const min_value = 1
 const max_value = 10
 const min_weight = 4
 const max_weight = 10
 
-var allowed_weight int
-
 type Item struct {
 	value, weight int
 	is_selected   bool
@@ -45,6 +44,25 @@ func copy_items(items []Item) []Item {
 	return new_items
 }
 
+// Return a copy of the items with nothing selected.
+// The empty selection always fits, so it's the fallback for every solver.
+func empty_solution(items []Item) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = false
+	}
+	return new_items
+}
+
+// Return a copy of the items with is_selected taken from selection.
+func apply_selection(items []Item, selection []bool) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = selection[i]
+	}
+	return new_items
+}
+
 // Return the total value of the items.
 // If add_all is false, only add up the selected items.
 func sum_values(items []Item, add_all bool) int {
@@ -98,6 +116,10 @@ func print_selected(items []Item) {
 	fmt.Println()
 }
 
+// Run an algorithm and print its solution. Calls counts the nodes the
+// search visits.
+// The algorithms work on their own copy of the items, so they never
+// change the caller's.
 func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allowed_weight int) {
 	// Copy the items so the run isn't influenced by a previous run.
 	test_items := copy_items(items)
@@ -120,30 +142,55 @@ func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allow
 // Return the best assignment, value of that assignment,
 // and the number of function calls we made.
 func exhaustive_search(items []Item, allowed_weight int) ([]Item, int, int) {
-	return do_exhaustive_search(items, allowed_weight, 0)
+	items = copy_items(items)
+	// Remember only which items the best selection has, and build
+	// the solution once at the end.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, 0, 0, 0, best_selection, -1)
+	// Only a negative allowed_weight makes every leaf too heavy.
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return apply_selection(items, best_selection), best_value, function_calls
 }
 
-func do_exhaustive_search(items []Item, allowed_weight, next_index int) ([]Item, int, int) {
+// Keep the running value and weight of the selected items so the leaves
+// don't have to add them up. When a leaf beats best_value, record its
+// selection in best_selection. Return the new best value and the
+// number of function calls we made.
+func do_exhaustive_search(items []Item, allowed_weight, next_index, current_value, current_weight int, best_selection []bool, best_value int) (int, int) {
 	if next_index >= len(items) {
-		return copy_items(items), solution_value(items, allowed_weight), 1
+		if current_weight <= allowed_weight && current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
 	}
 	//try to add item
 	items[next_index].is_selected = true
-	best_items, best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value+items[next_index].value, current_weight+items[next_index].weight, best_selection, best_value)
 	//try to remove item
 	items[next_index].is_selected = false
-	other_items, other_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
-	function_calls += other_calls
-	if other_value > best_value {
-		best_items = other_items
-		best_value = other_value
-	}
-	return best_items, best_value, function_calls+1
+	best_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value, current_weight, best_selection, best_value)
+	return best_value, function_calls + other_calls + 1
+}
+
+// Say that we skip an algorithm because the instance has more items
+// than limit, the constant named limit_name. Raise the constant to run
+// it anyway: without pruning, its search tree has 2^(n+1) - 1 nodes.
+func print_too_many_items(algorithm, limit_name string, limit, num_items int) {
+	fmt.Printf("Too many items for %s: %d items, more than %s = %d\n", algorithm, num_items, limit_name, limit)
+	fmt.Printf("Its search tree has up to 2^%d - 1 nodes\n", num_items+1)
+	fmt.Println()
 }
 
 func main() {
 	items := make_items(num_items, min_value, max_value, min_weight, max_weight)
-	allowed_weight = sum_weights(items, true) / 2
+	allowed_weight := sum_weights(items, true) / 2
 
 	// Display basic parameters.
 	fmt.Println("*** Parameters ***")
@@ -154,8 +201,8 @@ func main() {
 	fmt.Println()
 
 	// Exhaustive search
-	if num_items > 25 { // Only run exhaustive search if num_items <= 25.
-		fmt.Println("Too many items for exhaustive search\n")
+	if num_items > max_exhaustive_items {
+		print_too_many_items("exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
 	} else {
 		fmt.Println("*** Exhaustive Search ***")
 		run_algorithm(exhaustive_search, items, allowed_weight)
@@ -8,15 +8,14 @@ import (
 	"time"
 )
 
-const num_items = 20 // A reasonable value for exhaustive search.
+const num_items = 20                  // A reasonable value for exhaustive search.
+const max_branch_and_bound_items = 45 // Most items branch and bound runs on.
 
 const min_value = 1
 const max_value = 10
 const min_weight = 4
 const max_weight = 10
 
-var allowed_weight int
-
 type Item struct {
 	value, weight int
 	is_selected   bool
@@ -45,6 +44,25 @@ func copy_items(items []Item) []Item {
 	return new_items
 }
 
+// Return a copy of the items with nothing selected.
+// The empty selection always fits, so it's the fallback for every solver.
+func empty_solution(items []Item) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = false
+	}
+	return new_items
+}
+
+// Return a copy of the items with is_selected taken from selection.
+func apply_selection(items []Item, selection []bool) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = selection[i]
+	}
+	return new_items
+}
+
 // Return the total value of the items.
 // If add_all is false, only add up the selected items.
 func sum_values(items []Item, add_all bool) int {
@@ -98,6 +116,10 @@ func print_selected(items []Item) {
 	fmt.Println()
 }
 
+// Run an algorithm and print its solution. Calls counts the nodes the
+// search visits, pruned ones included.
+// The algorithms work on their own copy of the items, so they never
+// change the caller's.
 func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allowed_weight int) {
 	// Copy the items so the run isn't influenced by a previous run.
 	test_items := copy_items(items)
@@ -117,7 +139,7 @@ func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allow
 }
 
 func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
+	items = copy_items(items)
 	current_value := 0
 	current_weight := 0
 	remaing_value := 0
@@ -125,52 +147,57 @@ func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
 		remaing_value += item.value
 	}
 
-	return do_branch_and_bound(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+	// Remember only which items the best selection has, and build the
+	// solution once at the end. The empty selection is the starting
+	// incumbent, so we always have a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_branch_and_bound(items, allowed_weight, 0, best_selection, 0, current_value, current_weight, remaing_value)
+	return apply_selection(items, best_selection), best_value, function_calls
 }
 
-func do_branch_and_bound(items []Item, allowed_weight, next_index, best_value, current_value, current_weight, remaing_value int) ([]Item, int, int) {
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_branch_and_bound(items []Item, allowed_weight, next_index int, best_selection []bool, best_value, current_value, current_weight, remaing_value int) (int, int) {
 	if next_index >= len(items) {
-		copied_Items := copy_items(items)
-		return copied_Items, current_value, 1
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
 	}
 
 	if current_value+remaing_value <= best_value {
-		return nil, current_value, 1
+		return best_value, 1
 	}
 
-	var sol_items1 []Item
-	var sol_value1 int
-	var sol_calls1 int
+	function_calls := 1
+	var calls int
 
 	if current_weight+items[next_index].weight <= allowed_weight {
 		items[next_index].is_selected = true
-		sol_items1, sol_value1, sol_calls1 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
-		if sol_value1 > best_value {
-			best_value = sol_value1
-		}
-	} else {
-		sol_items1, sol_value1, sol_calls1 = nil, 0, 1
+		best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
+		function_calls += calls
 	}
 
-	var sol_items2 []Item
-	var sol_value2 int
-	var sol_calls2 int
-
 	items[next_index].is_selected = false
-	sol_items2, sol_value2, sol_calls2 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value, current_weight, remaing_value-items[next_index].value)
-
-	sol_calls1 += sol_calls2
-	if sol_value1 > sol_value2 {
-		return sol_items1, sol_value1, sol_calls1 + 1
-	} else {
-		return sol_items2, sol_value2, sol_calls1 + 1
-	}
+	best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, best_value, current_value, current_weight, remaing_value-items[next_index].value)
+	return best_value, function_calls + calls
+}
 
+// Say that we skip an algorithm because the instance has more items
+// than limit, the constant named limit_name. Raise the constant to run
+// it anyway: without pruning, its search tree has 2^(n+1) - 1 nodes.
+func print_too_many_items(algorithm, limit_name string, limit, num_items int) {
+	fmt.Printf("Too many items for %s: %d items, more than %s = %d\n", algorithm, num_items, limit_name, limit)
+	fmt.Printf("Its search tree has up to 2^%d - 1 nodes\n", num_items+1)
+	fmt.Println()
 }
 
 func main() {
 	items := make_items(num_items, min_value, max_value, min_weight, max_weight)
-	allowed_weight = sum_weights(items, true) / 2
+	allowed_weight := sum_weights(items, true) / 2
 
 	// Display basic parameters.
 	fmt.Println("*** Parameters ***")
@@ -181,8 +208,8 @@ func main() {
 	fmt.Println()
 
 	// branch_and_bound search
-	if num_items > 45 { // Only run branch_and_bound search if num_items <= 25.
-		fmt.Println("Too many items for branch_and_bound search\n")
+	if num_items > max_branch_and_bound_items {
+		print_too_many_items("branch and bound", "max_branch_and_bound_items", max_branch_and_bound_items, num_items)
 	} else {
 		fmt.Println("*** branch_and_bound ***")
 		run_algorithm(branch_and_bound, items, allowed_weight)
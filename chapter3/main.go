@@ -9,18 +9,20 @@ import (
 	"time"
 )
 
-const num_items = 40 // A reasonable value for exhaustive search.
+const num_items = 40                  // A reasonable value for exhaustive search.
+const max_exhaustive_items = 25       // Most items exhaustive search runs on.
+const max_branch_and_bound_items = 45 // Most items branch and bound runs on.
+const max_rods_items = 85             // Most items Rod's technique runs on.
+const max_rods_sorted_items = 350     // Most items Rod's sorted technique runs on.
 
 const min_value = 1
 const max_value = 10
 const min_weight = 4
 const max_weight = 10
 
-var allowed_weight int
-
 type Item struct {
-	id, blocked_by int
-	block_list     []int // Other items that this one blocks.
+	id, blocked_by int   // blocked_by is the position of the blocking item, or -1.
+	block_list     []int // Positions of other items that this one blocks.
 	value, weight  int
 	is_selected    bool
 }
@@ -43,9 +45,32 @@ func make_items(num_items, min_value, max_value, min_weight, max_weight int) []I
 }
 
 // Return a copy of the items slice.
+// The block lists are copied too, so the copy doesn't share them.
 func copy_items(items []Item) []Item {
 	new_items := make([]Item, len(items))
 	copy(new_items, items)
+	for i := range new_items {
+		new_items[i].block_list = append([]int(nil), items[i].block_list...)
+	}
+	return new_items
+}
+
+// Return a copy of the items with nothing selected.
+// The empty selection always fits, so it's the fallback for every solver.
+func empty_solution(items []Item) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = false
+	}
+	return new_items
+}
+
+// Return a copy of the items with is_selected taken from selection.
+func apply_selection(items []Item, selection []bool) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = selection[i]
+	}
 	return new_items
 }
 
@@ -102,6 +127,11 @@ func print_selected(items []Item) {
 	fmt.Println()
 }
 
+// Run an algorithm and print its solution. Calls counts the nodes a
+// search visits, pruned ones included, so the numbers compare across
+// algorithms.
+// The algorithms work on their own copy of the items, so they never
+// change the caller's.
 func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allowed_weight int) {
 	// Copy the items so the run isn't influenced by a previous run.
 	test_items := copy_items(items)
@@ -121,29 +151,45 @@ func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allow
 }
 
 func exhaustive_search(items []Item, allowed_weight int) ([]Item, int, int) {
-	return do_exhaustive_search(items, allowed_weight, 0)
+	items = copy_items(items)
+	// Remember only which items the best selection has, and build
+	// the solution once at the end.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, 0, 0, 0, best_selection, -1)
+	// Only a negative allowed_weight makes every leaf too heavy.
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return apply_selection(items, best_selection), best_value, function_calls
 }
 
-func do_exhaustive_search(items []Item, allowed_weight, next_index int) ([]Item, int, int) {
+// Keep the running value and weight of the selected items so the leaves
+// don't have to add them up. When a leaf beats best_value, record its
+// selection in best_selection. Return the new best value and the
+// number of function calls we made.
+func do_exhaustive_search(items []Item, allowed_weight, next_index, current_value, current_weight int, best_selection []bool, best_value int) (int, int) {
 	if next_index >= len(items) {
-		return copy_items(items), solution_value(items, allowed_weight), 1
+		if current_weight <= allowed_weight && current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
 	}
 	//try to add item
 	items[next_index].is_selected = true
-	best_items, best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value+items[next_index].value, current_weight+items[next_index].weight, best_selection, best_value)
 	//try to remove item
 	items[next_index].is_selected = false
-	other_items, other_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
-	function_calls += other_calls
-	if other_value > best_value {
-		best_items = other_items
-		best_value = other_value
-	}
-	return best_items, best_value, function_calls + 1
+	best_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value, current_weight, best_selection, best_value)
+	return best_value, function_calls + other_calls + 1
 }
 
 func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
+	items = copy_items(items)
 	current_value := 0
 	current_weight := 0
 	remaing_value := 0
@@ -151,51 +197,47 @@ func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
 		remaing_value += item.value
 	}
 
-	return do_branch_and_bound(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+	// Remember only which items the best selection has, and build the
+	// solution once at the end. The empty selection is the starting
+	// incumbent, so we always have a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_branch_and_bound(items, allowed_weight, 0, best_selection, 0, current_value, current_weight, remaing_value)
+	return apply_selection(items, best_selection), best_value, function_calls
 }
 
-func do_branch_and_bound(items []Item, allowed_weight, next_index, best_value, current_value, current_weight, remaing_value int) ([]Item, int, int) {
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_branch_and_bound(items []Item, allowed_weight, next_index int, best_selection []bool, best_value, current_value, current_weight, remaing_value int) (int, int) {
 	if next_index >= len(items) {
-		copied_Items := copy_items(items)
-		return copied_Items, current_value, 1
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
 	}
 
 	if current_value+remaing_value <= best_value {
-		return nil, current_value, 1
+		return best_value, 1
 	}
 
-	var sol_items1 []Item
-	var sol_value1 int
-	var sol_calls1 int
+	function_calls := 1
+	var calls int
 
 	if current_weight+items[next_index].weight <= allowed_weight {
 		items[next_index].is_selected = true
-		sol_items1, sol_value1, sol_calls1 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
-		if sol_value1 > best_value {
-			best_value = sol_value1
-		}
-	} else {
-		sol_items1, sol_value1, sol_calls1 = nil, 0, 1
+		best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
+		function_calls += calls
 	}
 
-	var sol_items2 []Item
-	var sol_value2 int
-	var sol_calls2 int
-
 	items[next_index].is_selected = false
-	sol_items2, sol_value2, sol_calls2 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value, current_weight, remaing_value-items[next_index].value)
-
-	sol_calls1 += sol_calls2
-	if sol_value1 > sol_value2 {
-		return sol_items1, sol_value1, sol_calls1 + 1
-	} else {
-		return sol_items2, sol_value2, sol_calls1 + 1
-	}
-
+	best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, best_value, current_value, current_weight, remaing_value-items[next_index].value)
+	return best_value, function_calls + calls
 }
 
 func rods_technique(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
+	items = copy_items(items)
 	current_value := 0
 	current_weight := 0
 	remaing_value := 0
@@ -205,52 +247,51 @@ func rods_technique(items []Item, allowed_weight int) ([]Item, int, int) {
 
 	make_block_lists(items)
 
-	return do_rods_technique(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_rods_technique(items, allowed_weight, 0, best_selection, 0, current_value, current_weight, remaing_value)
+	return apply_selection(items, best_selection), best_value, function_calls
 }
 
-func do_rods_technique(items []Item, allowed_weight, next_index, best_value, current_value, current_weight, remaing_value int) ([]Item, int, int) {
+// Like do_branch_and_bound, but an item may only be selected if no
+// item that dominates it was left out. remaing_value only counts the
+// undecided items that aren't blocked, since blocked items can't add
+// anything.
+func do_rods_technique(items []Item, allowed_weight, next_index int, best_selection []bool, best_value, current_value, current_weight, remaing_value int) (int, int) {
 	if next_index >= len(items) {
-		copied_Items := copy_items(items)
-		return copied_Items, current_value, 1
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
 	}
 
 	if current_value+remaing_value <= best_value {
-		return nil, current_value, 1
+		return best_value, 1
 	}
 
-	var sol_items1 []Item
-	sol_items1 = nil
-	sol_value1 := 0
-	sol_calls1 := 0
+	function_calls := 1
+	var calls int
 
+	// A blocked item's value was taken out of remaing_value when it was blocked.
 	if items[next_index].blocked_by == -1 {
+		remaing_value -= items[next_index].value
 		if current_weight+items[next_index].weight <= allowed_weight {
 			items[next_index].is_selected = true
-			sol_items1, sol_value1, sol_calls1 = do_rods_technique(items, allowed_weight, next_index+1, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
-			if sol_value1 > best_value {
-				best_value = sol_value1
-			}
+			best_value, calls = do_rods_technique(items, allowed_weight, next_index+1, best_selection, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value)
+			function_calls += calls
 		}
 	}
-	var sol_items2 []Item
-	var sol_value2 int
-	var sol_calls2 int
 
 	items[next_index].is_selected = false
-	block_items(items[next_index], items)
-	sol_items2, sol_value2, sol_calls2 = do_rods_technique(items, allowed_weight, next_index+1, best_value, current_value, current_weight, remaing_value-items[next_index].value)
-	unblock_items(items[next_index], items)
-	sol_calls1 += sol_calls2
-	if sol_value1 > sol_value2 {
-		return sol_items1, sol_value1, sol_calls1 + 1
-	} else {
-
-		return sol_items2, sol_value2, sol_calls1 + 1
-	}
+	blocked_value := block_items(next_index, items)
+	best_value, calls = do_rods_technique(items, allowed_weight, next_index+1, best_selection, best_value, current_value, current_weight, remaing_value-blocked_value)
+	unblock_items(next_index, items)
+	return best_value, function_calls + calls
 }
 
 func rods_technique_sorted(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
 	current_value := 0
 	current_weight := 0
 	remaing_value := 0
@@ -258,56 +299,131 @@ func rods_technique_sorted(items []Item, allowed_weight int) ([]Item, int, int)
 		remaing_value += item.value
 	}
 
-	make_block_lists(items)
-	// Sort so items with longer blocked lists come first.
-	sort.Slice(items, func(i, j int) bool {
-		return len(items[i].block_list) > len(items[j].block_list)
+	// Sort so items that dominate more items come first. Sorting the
+	// positions lets us move the dominance lists to the new positions
+	// instead of computing them again.
+	dominated := dominance_lists(items)
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return len(dominated[order[i]]) > len(dominated[order[j]])
 	})
-
-	// Reset the items' IDs.
-	for i := range items {
-		items[i].id = i
+	new_position := make([]int, len(items))
+	for k, i := range order {
+		new_position[i] = k
 	}
-
-	// Rebuild the blocked lists with the new indices.
-	make_block_lists(items)
-
-	return do_rods_technique(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+	sorted_items := make([]Item, len(items))
+	sorted_dominated := make([][]int, len(items))
+	for k, i := range order {
+		sorted_items[k] = items[i]
+		for _, j := range dominated[i] {
+			sorted_dominated[k] = append(sorted_dominated[k], new_position[j])
+		}
+	}
+	set_block_lists(sorted_items, sorted_dominated)
+
+	// Search the sorted copy, then map the selection back to the
+	// caller's order.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_rods_technique(sorted_items, allowed_weight, 0, best_selection, 0, current_value, current_weight, remaing_value)
+	selection := make([]bool, len(items))
+	for k, i := range order {
+		selection[i] = best_selection[k]
+	}
+	return apply_selection(items, selection), best_value, function_calls
 }
 
+// Give each item the block list of the later items it dominates.
 func make_block_lists(items []Item) {
-	for i, item := range items {
+	set_block_lists(items, dominance_lists(items))
+}
+
+// Make each item's block list the positions in its dominance list that
+// come after it. By the time an earlier item is blocked it has already
+// been decided, so blocking it would only cost time.
+func set_block_lists(items []Item, dominated [][]int) {
+	for i := range items {
 		items[i].block_list = make([]int, 0)
-		for j, other_item := range items {
-			if i == j {
-				continue
+		for _, j := range dominated[i] {
+			if j > i {
+				items[i].block_list = append(items[i].block_list, j)
 			}
-			if item.weight <= other_item.weight && item.value >= other_item.value {
-				items[i].block_list = append(items[i].block_list, items[j].id)
+		}
+	}
+}
+
+// Return, for each item, the positions of the items it dominates.
+// Of two identical items, only the earlier one dominates the other,
+// so they can't block each other.
+// Sweep the items by increasing weight, then decreasing value, then
+// position: everything an item dominates comes after it in that order,
+// so we only need to compare it with the items that follow.
+func dominance_lists(items []Item) [][]int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := items[order[i]], items[order[j]]
+		if a.weight != b.weight {
+			return a.weight < b.weight
+		}
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return order[i] < order[j]
+	})
+
+	dominated := make([][]int, len(items))
+	for k, i := range order {
+		for _, j := range order[k+1:] {
+			if items[j].value <= items[i].value {
+				dominated[i] = append(dominated[i], j)
 			}
 		}
 	}
+	return dominated
 }
 
-func block_items(source Item, items []Item) {
-	for _, blocked_by := range source.block_list {
-		if items[blocked_by].blocked_by == -1 {
-			items[blocked_by].blocked_by = source.id
+// Block the items in the block list of the item at position source.
+// Block lists and blocked_by hold positions, not ids, so the ids can be anything.
+// Return the total value of the undecided items after source we blocked.
+func block_items(source int, items []Item) int {
+	blocked_value := 0
+	for _, blocked := range items[source].block_list {
+		if items[blocked].blocked_by == -1 {
+			items[blocked].blocked_by = source
+			if blocked > source {
+				blocked_value += items[blocked].value
+			}
 		}
 	}
+	return blocked_value
 }
 
-func unblock_items(source Item, items []Item) {
-	for _, blocked_by := range source.block_list {
-		if items[blocked_by].blocked_by == source.id {
-			items[blocked_by].blocked_by = -1
+// Unblock the items that the item at position source blocked.
+func unblock_items(source int, items []Item) {
+	for _, blocked := range items[source].block_list {
+		if items[blocked].blocked_by == source {
+			items[blocked].blocked_by = -1
 		}
 	}
 }
 
+// Say that we skip an algorithm because the instance has more items
+// than limit, the constant named limit_name. Raise the constant to run
+// it anyway: without pruning, its search tree has 2^(n+1) - 1 nodes.
+func print_too_many_items(algorithm, limit_name string, limit, num_items int) {
+	fmt.Printf("Too many items for %s: %d items, more than %s = %d\n", algorithm, num_items, limit_name, limit)
+	fmt.Printf("Its search tree has up to 2^%d - 1 nodes\n", num_items+1)
+	fmt.Println()
+}
+
 func main() {
 	items := make_items(num_items, min_value, max_value, min_weight, max_weight)
-	allowed_weight = sum_weights(items, true) / 2
+	allowed_weight := sum_weights(items, true) / 2
 
 	// Display basic parameters.
 	fmt.Println("*** Parameters ***")
@@ -318,30 +434,30 @@ func main() {
 	fmt.Println()
 
 	// Exhaustive search
-	if num_items > 25 { // Only run exhaustive search if num_items <= 25.
-		fmt.Println("Too many items for exhaustive search\n")
+	if num_items > max_exhaustive_items {
+		print_too_many_items("exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
 	} else {
 		fmt.Println("*** Exhaustive Search ***")
 		run_algorithm(exhaustive_search, items, allowed_weight)
 	}
 
 	// branch_and_bound search
-	if num_items > 45 { // Only run branch_and_bound search if num_items <= 25.
-		fmt.Println("Too many items for branch_and_bound search\n")
+	if num_items > max_branch_and_bound_items {
+		print_too_many_items("branch and bound", "max_branch_and_bound_items", max_branch_and_bound_items, num_items)
 	} else {
 		fmt.Println("*** branch_and_bound ***")
 		run_algorithm(branch_and_bound, items, allowed_weight)
 	}
 	// Rod's technique
-	if num_items > 85 { // Only use Rod's technique if num_items <= 85.
-		fmt.Println("Too many items for Rod's technique\n")
+	if num_items > max_rods_items {
+		print_too_many_items("Rod's technique", "max_rods_items", max_rods_items, num_items)
 	} else {
 		fmt.Println("*** Rod's technique ***")
 		run_algorithm(rods_technique, items, allowed_weight)
 	}
 	// Rod's sorted technique
-	if num_items > 350 { // Only use Rod's technique if num_items <= 85.
-		fmt.Println("Too many items for Rod's sorted  technique\n")
+	if num_items > max_rods_sorted_items {
+		print_too_many_items("Rod's sorted technique", "max_rods_sorted_items", max_rods_sorted_items, num_items)
 	} else {
 		fmt.Println("*** Rod's sorted technique ***")
 		run_algorithm(rods_technique_sorted, items, allowed_weight)
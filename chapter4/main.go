@@ -3,49 +3,205 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"math"
 	"math/rand"
+	"os"
+	"runtime"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const num_items = 40 // A reasonable value for exhaustive search.
+const num_items = 40                  // A reasonable value for exhaustive search.
+const max_exhaustive_items = 25       // Most items exhaustive search runs on.
+const max_branch_and_bound_items = 45 // Most items branch and bound runs on.
+const max_rods_items = 85             // Most items Rod's technique runs on.
+const max_rods_sorted_items = 350     // Most items Rod's sorted technique runs on.
 
 const min_value = 1
 const max_value = 10
 const min_weight = 4
 const max_weight = 10
 
-var allowed_weight int
+const num_restarts = 20 // Random restarts for hill climbing.
+const beam_width = 10   // Partial solutions kept by beam search. 0 means keep them all.
+
+const grasp_alpha = 0.3     // Fraction of the densest fitting items GRASP picks from.
+const grasp_iterations = 50 // GRASP constructions.
+
+const rounding_trials = 100 // Randomized rounding trials.
+
+const auto_exact_time_limit = 5 * time.Second // Time limit for the anytime branch and bound.
+
+const lns_iterations = 200       // Destroy-and-repair rounds for large neighborhood search.
+const lns_destroy_fraction = 0.3 // Fraction of the selected items each round removes.
+
+const max_quantity = 3 // Most copies of an item in the bounded knapsack.
+
+const num_groups = 5 // Option groups in the multiple-choice knapsack.
+
+const min_volume = 4
+const max_volume = 10
+const max_dp_cells = 100_000_000        // Largest table, in cells, the dynamic programs build.
+const parallel_dp_min_cells = 1_000_000 // Smallest table parallel dynamic programming splits across goroutines.
+const parallel_dp_items = 1000          // Items for the parallel dynamic programming demo, enough for a big table.
+const scale_factor = 4                  // Scaled dynamic programming divides the weights and capacity by this.
+const max_workers_per_cpu = 4           // Most goroutines per CPU the parallel algorithms use.
+
+const estimate_probes = 1000 // Random descents for the tree size estimate.
+
+var knapsack_capacities = []int{30, 40, 50} // Capacities for the multiple-knapsack problem.
+
+const max_items = 10 // Most items the cardinality-constrained knapsack may select.
+
+const max_front_points = 20 // Most points of the Pareto front we print. 0 means print them all.
+
+const max_printed_items = 100  // Most selected items a solution listing shows. 0 means show them all.
+const items_per_line = 0       // Selected items per line of a listing. 0 means all on one line.
+const show_value_weight = true // List each item as position(value, weight) rather than just its position.
+const wide_listing = false     // List one item per line in aligned columns, with its id and category.
+
+const knapsack_width = 80 // Characters in the drawing of the filled knapsack.
+
+var branch_orders = []string{"density", "weight-desc", "value-desc", "bound-impact"} // Orders ordered branch and bound tries.
+const bound_impact_candidates = 4                                                    // Undecided items the bound-impact order compares.
+
+const max_deviation = 3 // Most an item's worst-case weight exceeds its nominal weight.
+const robust_gamma = 3  // Most items that take their worst-case weight at once.
+
+const good_enough_value = 150 // Value at which the target-value mode stops searching.
+
+const closest_target = 100 // Value the closest-value mode aims for.
+
+var category_names = []string{"food", "gear", "electronics"}
+var category_limits = map[string]int{"food": 30, "gear": 40, "electronics": 50} // Weight limit of each category.
+
+// The weight and value we lose once when we select a category's first item.
+type setup_cost struct {
+	weight, value int
+}
+
+var category_setups = map[string]setup_cost{"gear": {5, 0}, "electronics": {10, 5}} // Setup cost of each category.
+
+var verification_failed bool // Set when some algorithm's solution doesn't check out.
 
 type Item struct {
-	id, blocked_by int
-	block_list     []int // Other items that this one blocks.
+	id, blocked_by int   // blocked_by is the position of the blocking item, or -1.
+	block_list     []int // Positions of other items that this one blocks.
 	value, weight  int
+	quantity       int // Copies available. The 0/1 algorithms assume 1.
 	is_selected    bool
+	num_selected   int    // Copies selected by the bounded algorithms.
+	group          int    // Option group for the multiple-choice knapsack.
+	volume         int    // Second resource for the two-dimensional knapsack.
+	knapsack       int    // Knapsack the item goes in for the multiple-knapsack problem.
+	requires       []int  // Other items that must be selected if this one is.
+	parent         int    // Item that must be selected for this one to be, or -1.
+	high_weight    int    // Worst-case weight for the robust knapsack. At least weight.
+	category       string // Category whose weight limit the item counts against.
 }
 
 // Make some random items.
 func make_items(num_items, min_value, max_value, min_weight, max_weight int) []Item {
+	source := new_random_item_source(num_items, min_value, max_value, min_weight, max_weight)
+	items := make([]Item, 0, num_items)
+	for item, ok := source.next(); ok; item, ok = source.next() {
+		items = append(items, item)
+	}
+	return items
+}
+
+// Something that hands out items one at a time, so algorithms that
+// look at each item once don't need them all in memory.
+type item_source interface {
+	// Return the next item, or false once there are no more.
+	next() (Item, bool)
+}
+
+// Generate random items one at a time, the same ones make_items makes.
+type random_item_source struct {
+	random                 *rand.Rand
+	next_id, num_items     int
+	min_value, max_value   int
+	min_weight, max_weight int
+}
+
+func new_random_item_source(num_items, min_value, max_value, min_weight, max_weight int) *random_item_source {
 	// Initialize a pseudorandom number generator.
 	//random := rand.New(rand.NewSource(time.Now().UnixNano())) // Initialize with a changing seed
 	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
 
-	items := make([]Item, num_items)
-	for i := 0; i < num_items; i++ {
-		items[i] = Item{
-			i, -1, nil,
-			random.Intn(max_value-min_value+1) + min_value,
-			random.Intn(max_weight-min_weight+1) + min_weight,
-			false}
+	return &random_item_source{random, 0, num_items, min_value, max_value, min_weight, max_weight}
+}
+
+func (source *random_item_source) next() (Item, bool) {
+	if source.next_id >= source.num_items {
+		return Item{}, false
+	}
+	item := Item{
+		source.next_id, -1, nil,
+		source.random.Intn(source.max_value-source.min_value+1) + source.min_value,
+		source.random.Intn(source.max_weight-source.min_weight+1) + source.min_weight,
+		1, false, 0, 0, 0, -1, nil, -1, 0, ""}
+	item.high_weight = item.weight
+	source.next_id++
+	return item, true
+}
+
+// Give each item a random number of copies between 1 and max_quantity.
+func make_quantities(items []Item, max_quantity int) {
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	for i := range items {
+		items[i].quantity = random.Intn(max_quantity) + 1
+	}
+}
+
+// Return how many copies of the item are selected.
+// The bounded algorithms set num_selected, the others only is_selected.
+func num_copies(item Item) int {
+	if !item.is_selected {
+		return 0
 	}
-	return items
+	if item.num_selected > 1 {
+		return item.num_selected
+	}
+	return 1
 }
 
 // Return a copy of the items slice.
+// The block and requirement lists are copied too, so the copy doesn't share them.
 func copy_items(items []Item) []Item {
 	new_items := make([]Item, len(items))
 	copy(new_items, items)
+	for i := range new_items {
+		new_items[i].block_list = append([]int(nil), items[i].block_list...)
+		new_items[i].requires = append([]int(nil), items[i].requires...)
+	}
+	return new_items
+}
+
+// Return a copy of the items with nothing selected.
+// The empty selection always fits, so it's the fallback for every solver.
+func empty_solution(items []Item) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = false
+	}
+	return new_items
+}
+
+// Return a copy of the items with is_selected taken from selection.
+func apply_selection(items []Item, selection []bool) []Item {
+	new_items := copy_items(items)
+	for i := range new_items {
+		new_items[i].is_selected = selection[i]
+	}
 	return new_items
 }
 
@@ -54,8 +210,10 @@ func copy_items(items []Item) []Item {
 func sum_values(items []Item, add_all bool) int {
 	total := 0
 	for i := 0; i < len(items); i++ {
-		if add_all || items[i].is_selected {
-			total += items[i].value
+		if add_all {
+			total += items[i].value * items[i].quantity
+		} else {
+			total += items[i].value * num_copies(items[i])
 		}
 	}
 	return total
@@ -66,8 +224,10 @@ func sum_values(items []Item, add_all bool) int {
 func sum_weights(items []Item, add_all bool) int {
 	total := 0
 	for i := 0; i < len(items); i++ {
-		if add_all || items[i].is_selected {
-			total += items[i].weight
+		if add_all {
+			total += items[i].weight * items[i].quantity
+		} else {
+			total += items[i].weight * num_copies(items[i])
 		}
 	}
 	return total
@@ -86,171 +246,566 @@ func solution_value(items []Item, allowed_weight int) int {
 	return sum_values(items, false)
 }
 
-// Print the selected items.
+// Print the selected items, at most max_printed_items of them, as
+// position(value, weight), or just the position if show_value_weight is
+// false. Put items_per_line of them on each line. With wide_listing,
+// print them one per line in aligned columns instead.
 func print_selected(items []Item) {
+	if wide_listing {
+		print_selected_wide(items)
+		return
+	}
+	num_printed, on_line := 0, 0
+	for i, item := range items {
+		if num_copies(item) == 0 {
+			continue
+		}
+		if max_printed_items > 0 && num_printed == max_printed_items {
+			fmt.Println("...")
+			return
+		}
+		entry := strconv.Itoa(i)
+		if show_value_weight {
+			entry = fmt.Sprintf("%d(%d, %d)", i, item.value, item.weight)
+		}
+		if num_copies(item) > 1 {
+			entry = fmt.Sprintf("%dx%s", num_copies(item), entry)
+		}
+		fmt.Print(entry + " ")
+		num_printed++
+		on_line++
+		if items_per_line > 0 && on_line == items_per_line {
+			fmt.Println()
+			on_line = 0
+		}
+	}
+	if on_line > 0 || num_printed == 0 {
+		fmt.Println()
+	}
+}
+
+// Print the selected items one per line, with their id, value, weight,
+// copies and category in aligned columns.
+func print_selected_wide(items []Item) {
+	fmt.Printf("%6s %6s %6s %6s %6s  %s\n", "Item", "Id", "Value", "Weight", "Copies", "Category")
 	num_printed := 0
 	for i, item := range items {
-		if item.is_selected {
-			fmt.Printf("%d(%d, %d) ", i, item.value, item.weight)
+		if num_copies(item) == 0 {
+			continue
 		}
-		num_printed += 1
-		if num_printed > 100 {
+		if max_printed_items > 0 && num_printed == max_printed_items {
 			fmt.Println("...")
 			return
 		}
+		fmt.Printf("%6d %6d %6d %6d %6d  %s\n", i, item.id, item.value, item.weight, num_copies(item), item.category)
+		num_printed++
+	}
+}
+
+// Draw the knapsack as a bar width characters wide (at least 3),
+// brackets included, with a segment for each selected item in
+// proportion to its weight and the slack at the end. Each segment
+// starts with a bar and the item's index. Runs of items too narrow for
+// their index are drawn together as one segment labeled "…". If the
+// items weigh more than the capacity, the bar is scaled to their
+// weight and the slack is negative.
+func render_knapsack(items []Item, capacity, width int) string {
+	inner := max(width-2, 1)
+	used := sum_weights(items, false)
+	scale := max(capacity, used, 1)
+	var bar strings.Builder
+	bar.WriteString("[")
+	cells, weight, run := 0, 0, 0
+	for i, item := range items {
+		if num_copies(item) == 0 {
+			continue
+		}
+		weight += item.weight * num_copies(item)
+		end := weight * inner / scale
+		label := strconv.Itoa(i)
+		if end-cells-run <= len(label) {
+			// Too narrow, so add it to the run of unlabeled items.
+			run = end - cells
+			continue
+		}
+		if run > 0 {
+			bar.WriteString(segment("…", run))
+			cells += run
+			run = 0
+		}
+		bar.WriteString(segment(label, end-cells))
+		cells = end
+	}
+	if run > 0 {
+		bar.WriteString(segment("…", run))
+		cells += run
+	}
+	bar.WriteString(strings.Repeat(" ", inner-cells))
+	bar.WriteString("]")
+	return fmt.Sprintf("%s\nWeight %d of %d, slack %d", bar.String(), used, capacity, capacity-used)
+}
+
+// Return a segment length characters long: a bar, the label, and
+// dashes. A segment too short for the bar and label is all "…".
+func segment(label string, length int) string {
+	if length <= len([]rune(label)) {
+		return strings.Repeat("…", length)
+	}
+	return "|" + label + strings.Repeat("-", length-1-len([]rune(label)))
+}
+
+// What a solver found out besides its solution. The solvers return it
+// instead of printing it, so the runner can print it after the timing
+// stops.
+type solver_stats struct {
+	unit        string // What the work count counts, if not nodes or cells.
+	stop        stop_reason
+	root_bound  int           // The bound the stop reason refers to.
+	upper_bound int           // The best bound on the optimum when the time ran out.
+	depths      *depth_counts // The nodes a tree search visited at each depth, or nil.
+	has_loss    bool          // Whether loss_bound bounds the value lost.
+	loss_bound  int           // How much less than the optimum an approximation may find.
+	details     []string      // One line per statistic of the solver.
+}
+
+// Why an exact search stopped.
+type stop_reason int
+
+const (
+	no_stop_reason      stop_reason = iota // Not an exact search.
+	met_root_bound                         // The incumbent reached the root bound.
+	searched_whole_tree                    // The search ran out of nodes.
+	time_limit_expired                     // The search ran out of time.
+)
+
+// A solver that also returns its statistics.
+type solver func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats)
+
+// Turn an algorithm without statistics into a solver.
+func no_stats(alg func([]Item, int) ([]Item, int, int)) solver {
+	return func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+		solution, total_value, function_calls := alg(items, allowed_weight)
+		return solution, total_value, function_calls, solver_stats{}
+	}
+}
+
+// Run an algorithm and print its solution. Calls counts the nodes a
+// tree search visits, pruned ones included, or the table cells a
+// dynamic program computes, so the numbers compare across algorithms.
+// Heuristics that count something else, like moves or trials, name it
+// in their solver_stats and it's printed instead of Calls.
+// The algorithms work on their own copy of the items, so they never
+// change the caller's.
+func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allowed_weight int) int {
+	return run_solver(no_stats(alg), items, allowed_weight, nil)
+}
+
+// Run a solver and print its solution, then its statistics. check
+// verifies the constraints of the variant the solver solves, if any.
+func run_solver(alg solver, items []Item, allowed_weight int, check constraint_check) int {
+	total_value, _ := run_and_print(alg, items, allowed_weight, check)
+	fmt.Println()
+	return total_value
+}
+
+// Run a heuristic and show how far its value is from the optimum.
+// If no exact algorithm ran (optimum < 0), compare with the upper bound instead.
+func run_heuristic(alg solver, items []Item, allowed_weight, optimum, upper_bound int) {
+	total_value, stats := run_and_print(alg, items, allowed_weight, nil)
+	print_gap(total_value, optimum, upper_bound)
+	if stats.has_loss {
+		print_loss_bound(stats.loss_bound, optimum)
 	}
 	fmt.Println()
 }
 
-func run_algorithm(alg func([]Item, int) ([]Item, int, int), items []Item, allowed_weight int) {
+// Print an approximation's bound on the value it loses, and compare it
+// with the optimum if we know it.
+func print_loss_bound(loss_bound, optimum int) {
+	if optimum > 0 {
+		fmt.Printf("Loss bound: %d (%.2f%% of the optimum)\n", loss_bound, 100*float64(loss_bound)/float64(optimum))
+	} else {
+		fmt.Printf("Loss bound: %d\n", loss_bound)
+	}
+}
+
+func run_and_print(alg solver, items []Item, allowed_weight int, check constraint_check) (int, solver_stats) {
+	result := time_solver(alg, items, allowed_weight)
+	print_result(result, items, allowed_weight, check)
+	return result.value, result.stats
+}
+
+// What a solver returned and how long it took.
+type solver_result struct {
+	name         string
+	solution     []Item
+	value, calls int
+	stats        solver_stats
+	elapsed      time.Duration
+}
+
+// Run a solver and time it.
+func time_solver(alg solver, items []Item, allowed_weight int) solver_result {
 	// Copy the items so the run isn't influenced by a previous run.
 	test_items := copy_items(items)
 
 	start := time.Now()
 
 	// Run the algorithm.
-	solution, total_value, function_calls := alg(test_items, allowed_weight)
+	solution, total_value, function_calls, stats := alg(test_items, allowed_weight)
 
 	elapsed := time.Since(start)
 
-	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
-	print_selected(solution)
-	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
-		total_value, sum_weights(solution, false), function_calls)
-	fmt.Println()
-}
-
-func exhaustive_search(items []Item, allowed_weight int) ([]Item, int, int) {
-	return do_exhaustive_search(items, allowed_weight, 0)
+	return solver_result{"", solution, total_value, function_calls, stats, elapsed}
 }
 
-func do_exhaustive_search(items []Item, allowed_weight, next_index int) ([]Item, int, int) {
-	if next_index >= len(items) {
-		return copy_items(items), solution_value(items, allowed_weight), 1
+// Print a solver's result, verify it, and print its statistics.
+func print_result(result solver_result, items []Item, allowed_weight int, check constraint_check) {
+	fmt.Printf("Elapsed: %f\n", result.elapsed.Seconds())
+	print_selected(result.solution)
+	fmt.Printf("Value: %d, Weight: %d, %s: %d\n",
+		result.value, sum_weights(result.solution, false), work_unit(result.stats), result.calls)
+	report_mismatch(verify_solution(items, result.solution, result.value, allowed_weight, check))
+	for _, line := range result.stats.details {
+		fmt.Println(line)
 	}
-	//try to add item
-	items[next_index].is_selected = true
-	best_items, best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
-	//try to remove item
-	items[next_index].is_selected = false
-	other_items, other_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1)
-	function_calls += other_calls
-	if other_value > best_value {
-		best_items = other_items
-		best_value = other_value
+	print_stop_reason(result.value, result.stats)
+	if result.stats.depths != nil {
+		print_depth_counts(result.stats.depths)
 	}
-	return best_items, best_value, function_calls + 1
 }
 
-func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
-	current_value := 0
-	current_weight := 0
-	remaing_value := 0
-	for _, item := range items {
-		remaing_value += item.value
+// Return the name of what a solver's work count counts.
+func work_unit(stats solver_stats) string {
+	if stats.unit != "" {
+		return stats.unit
 	}
+	return "Calls"
+}
 
-	return do_branch_and_bound(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+// A solver and the name to print it under.
+type named_solver struct {
+	name string
+	alg  solver
 }
 
-func do_branch_and_bound(items []Item, allowed_weight, next_index, best_value, current_value, current_weight, remaing_value int) ([]Item, int, int) {
-	if next_index >= len(items) {
-		copied_Items := copy_items(items)
-		return copied_Items, current_value, 1
+// Run each solver in its own goroutine on its own copy of the items.
+// Print each result as soon as its solver finishes, holding a lock so
+// the results don't interleave. The solvers compete for the CPUs, so
+// their times are longer than when they run one at a time.
+// Return the results in the solvers' order.
+func run_concurrently(solvers []named_solver, items []Item, allowed_weight int) []solver_result {
+	results := make([]solver_result, len(solvers))
+	var print_lock sync.Mutex
+	var done sync.WaitGroup
+	for k, named := range solvers {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			result := time_solver(named.alg, items, allowed_weight)
+			result.name = named.name
+
+			print_lock.Lock()
+			defer print_lock.Unlock()
+			fmt.Printf("*** %s ***\n", named.name)
+			print_result(result, items, allowed_weight, nil)
+			fmt.Println()
+			results[k] = result
+		}()
 	}
+	done.Wait()
+	return results
+}
 
-	if current_value+remaing_value <= best_value {
-		return nil, current_value, 1
+// Print a table comparing the solvers' results.
+func print_comparison(results []solver_result) {
+	fmt.Printf("%-28s %8s %22s %12s\n", "Algorithm", "Value", "Work", "Elapsed")
+	for _, result := range results {
+		work := fmt.Sprintf("%d %s", result.calls, strings.ToLower(work_unit(result.stats)))
+		fmt.Printf("%-28s %8d %22s %12f\n", result.name, result.value, work, result.elapsed.Seconds())
 	}
+}
 
-	var sol_items1 []Item
-	var sol_value1 int
-	var sol_calls1 int
+// Return the solvers -concurrent runs: the exact algorithms the
+// instance isn't too big for, and the heuristics.
+func concurrent_solvers(items []Item, allowed_weight, workers int) []named_solver {
+	var solvers []named_solver
+	if len(items) <= max_exhaustive_items {
+		solvers = append(solvers,
+			named_solver{"Exhaustive search", no_stats(exhaustive_search)},
+			named_solver{"Parallel exhaustive search", no_stats(func(items []Item, allowed_weight int) ([]Item, int, int) {
+				return parallel_exhaustive_search(items, allowed_weight, workers)
+			})})
+	}
+	if len(items) <= max_branch_and_bound_items {
+		solvers = append(solvers, named_solver{"Branch and bound", branch_and_bound})
+	}
+	if len(items) <= max_rods_items {
+		solvers = append(solvers, named_solver{"Rod's technique", rods_technique})
+	}
+	if len(items) <= max_rods_sorted_items {
+		solvers = append(solvers,
+			named_solver{"Rod's sorted technique", rods_technique_sorted},
+			named_solver{"Parallel Rod's technique", func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+				return parallel_rods_technique(items, allowed_weight, workers)
+			}})
+	}
+	if check_dynamic_programming_size(items, allowed_weight) == nil {
+		solvers = append(solvers, named_solver{"Dynamic programming", no_stats(dynamic_programming)})
+	}
+	return append(solvers,
+		named_solver{"Hill climbing", hill_climbing},
+		named_solver{"Beam search", beam_search},
+		named_solver{"GRASP", grasp},
+		named_solver{"Randomized rounding", randomized_rounding},
+		named_solver{"Large neighborhood search", large_neighborhood_search},
+		named_solver{"Scaled dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+			return scaled_dynamic_programming(items, allowed_weight, scale_factor)
+		}},
+		named_solver{"Auto exact", auto_exact})
+}
 
-	if current_weight+items[next_index].weight <= allowed_weight {
-		items[next_index].is_selected = true
-		sol_items1, sol_value1, sol_calls1 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
-		if sol_value1 > best_value {
-			best_value = sol_value1
-		}
-	} else {
-		sol_items1, sol_value1, sol_calls1 = nil, 0, 1
+// Say so if a solution failed verification.
+func report_mismatch(err error) {
+	if err != nil {
+		fmt.Printf("*** MISMATCH: %v ***\n", err)
+		verification_failed = true
 	}
+}
 
-	var sol_items2 []Item
-	var sol_value2 int
-	var sol_calls2 int
+// A check of the constraints a variant adds to the knapsack. It returns
+// an error describing the first one the solution breaks, or nil.
+type constraint_check func(solution []Item) error
 
-	items[next_index].is_selected = false
-	sol_items2, sol_value2, sol_calls2 = do_branch_and_bound(items, allowed_weight, next_index+1, best_value, current_value, current_weight, remaing_value-items[next_index].value)
+// Recompute the value and weight of a solution and check that it
+// fits, is worth the claimed value, and meets the requirements and
+// parents the items carry. The empty selection fits any capacity,
+// even a negative one, where it is the only solution. check, if not
+// nil, checks the variant's other constraints. Return an error
+// describing the first problem, or nil if the solution checks out.
+func verify_solution(items, solution []Item, claimed_value, allowed_weight int, check constraint_check) error {
+	if solution == nil {
+		return fmt.Errorf("no solution returned")
+	}
+	if len(solution) != len(items) {
+		return fmt.Errorf("the solution has %d items, but the problem has %d", len(solution), len(items))
+	}
+	if weight := sum_weights(solution, false); weight > allowed_weight && count_selected(solution) > 0 {
+		return fmt.Errorf("the solution weighs %d, more than the allowed weight %d", weight, allowed_weight)
+	}
+	if value := sum_values(solution, false); value != claimed_value {
+		return fmt.Errorf("the solution is worth %d, but the algorithm claimed %d", value, claimed_value)
+	}
+	for i, item := range solution {
+		if !item.is_selected {
+			continue
+		}
+		for _, r := range item.requires {
+			if !solution[r].is_selected {
+				return fmt.Errorf("the solution selects item %d without item %d, which it requires", i, r)
+			}
+		}
+		if item.parent != -1 && !solution[item.parent].is_selected {
+			return fmt.Errorf("the solution selects item %d without its parent %d", i, item.parent)
+		}
+	}
+	if check != nil {
+		return check(solution)
+	}
+	return nil
+}
 
-	sol_calls1 += sol_calls2
-	if sol_value1 > sol_value2 {
-		return sol_items1, sol_value1, sol_calls1 + 1
-	} else {
-		return sol_items2, sol_value2, sol_calls1 + 1
+// Check that a solution's volume is at most allowed_volume.
+func within_volume(allowed_volume int) constraint_check {
+	return func(solution []Item) error {
+		if volume := sum_volumes(solution, false); volume > allowed_volume {
+			return fmt.Errorf("the solution has volume %d, more than the allowed volume %d", volume, allowed_volume)
+		}
+		return nil
 	}
+}
 
+// Check that a solution takes no more copies of an item than it has.
+func within_quantities(solution []Item) error {
+	for i, item := range solution {
+		if copies := num_copies(item); copies > item.quantity {
+			return fmt.Errorf("the solution takes %d copies of item %d, which has %d", copies, i, item.quantity)
+		}
+	}
+	return nil
 }
 
-func rods_technique(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
-	current_value := 0
-	current_weight := 0
-	remaing_value := 0
-	for _, item := range items {
-		remaing_value += item.value
+// Check that a solution selects at most max_items items.
+func at_most_items(max_items int) constraint_check {
+	return func(solution []Item) error {
+		if count := count_selected(solution); count > max_items {
+			return fmt.Errorf("the solution selects %d items, more than %d", count, max_items)
+		}
+		return nil
 	}
+}
 
-	make_block_lists(items)
+func run_quadratic(alg func([]Item, int, []synergy) ([]Item, int, int), items []Item, allowed_weight int, synergies []synergy) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls := alg(test_items, allowed_weight, synergies)
+
+	elapsed := time.Since(start)
 
-	return do_rods_technique(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_selected(solution)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), function_calls)
+	bonus := quadratic_value(solution, synergies) - sum_values(solution, false)
+	fmt.Printf("Synergy bonus: %d\n", bonus)
+	// The claimed value includes the bonus, so compare without it.
+	report_mismatch(verify_solution(items, solution, total_value-bonus, allowed_weight, nil))
+	fmt.Println()
 }
 
-func do_rods_technique(items []Item, allowed_weight, next_index, best_value, current_value, current_weight, remaing_value int) ([]Item, int, int) {
-	if next_index >= len(items) {
-		copied_Items := copy_items(items)
-		return copied_Items, current_value, 1
+// Print the absolute and relative gap between a value and the optimum.
+// Without an optimum, the gap to the upper bound only limits how far
+// from optimal the value can be.
+func print_gap(value, optimum, upper_bound int) {
+	switch {
+	case optimum >= 0:
+		fmt.Printf("Gap: %d (%.2f%%)\n", optimum-value, relative_gap(value, optimum))
+	case upper_bound >= 0:
+		fmt.Printf("Gap: <= %d (<= %.2f%% from optimal)\n", upper_bound-value, relative_gap(value, upper_bound))
+	default:
+		fmt.Println("Gap: unknown")
 	}
+}
 
-	if current_value+remaing_value <= best_value {
-		return nil, current_value, 1
+// Return the gap between a value and a reference value as a percentage
+// of the reference value. A zero reference can only be matched, so the
+// gap is zero.
+func relative_gap(value, reference int) float64 {
+	if reference == 0 {
+		return 0
 	}
+	return 100 * float64(reference-value) / float64(reference)
+}
 
-	var sol_items1 []Item
-	sol_items1 = nil
-	sol_value1 := 0
-	sol_calls1 := 0
+func exhaustive_search(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	// Remember only which items the best selection has, and build
+	// the solution once at the end.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, 0, 0, 0, best_selection, -1)
+	// Only a negative allowed_weight makes every leaf too heavy.
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return apply_selection(items, best_selection), best_value, function_calls
+}
 
-	if items[next_index].blocked_by == -1 {
-		if current_weight+items[next_index].weight <= allowed_weight {
-			items[next_index].is_selected = true
-			sol_items1, sol_value1, sol_calls1 = do_rods_technique(items, allowed_weight, next_index+1, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value)
-			if sol_value1 > best_value {
-				best_value = sol_value1
+// Keep the running value and weight of the selected items so the leaves
+// don't have to add them up. When a leaf beats best_value, record its
+// selection in best_selection. Return the new best value and the
+// number of function calls we made.
+func do_exhaustive_search(items []Item, allowed_weight, next_index, current_value, current_weight int, best_selection []bool, best_value int) (int, int) {
+	if next_index >= len(items) {
+		if current_weight <= allowed_weight && current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
 			}
 		}
+		return best_value, 1
 	}
-	var sol_items2 []Item
-	var sol_value2 int
-	var sol_calls2 int
-
+	//try to add item
+	items[next_index].is_selected = true
+	best_value, function_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value+items[next_index].value, current_weight+items[next_index].weight, best_selection, best_value)
+	//try to remove item
 	items[next_index].is_selected = false
-	block_items(items[next_index], items)
-	sol_items2, sol_value2, sol_calls2 = do_rods_technique(items, allowed_weight, next_index+1, best_value, current_value, current_weight, remaing_value-items[next_index].value)
-	unblock_items(items[next_index], items)
-	sol_calls1 += sol_calls2
-	if sol_value1 > sol_value2 {
-		return sol_items1, sol_value1, sol_calls1 + 1
-	} else {
+	best_value, other_calls := do_exhaustive_search(items, allowed_weight, next_index+1,
+		current_value, current_weight, best_selection, best_value)
+	return best_value, function_calls + other_calls + 1
+}
+
+// Like exhaustive_search, but split the search tree across workers
+// goroutines. Fix the selections of the first k items, where k is the
+// smallest number with 2^k >= 4 * workers so that no worker sits idle
+// for long, and search below each of those 2^k prefixes on the worker's
+// own copy of the items. Of the prefixes with the best value, we keep
+// the first in search order, so we find the same solution as
+// exhaustive_search.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func parallel_exhaustive_search(items []Item, allowed_weight, workers int) ([]Item, int, int) {
+	if workers < 2 || len(items) == 0 {
+		return exhaustive_search(items, allowed_weight)
+	}
+	k := 0
+	for 1<<k < 4*workers && k < len(items) {
+		k++
+	}
 
-		return sol_items2, sol_value2, sol_calls1 + 1
+	// Prefix p selects item t < k unless bit k-1-t of p is set,
+	// so that the prefixes are numbered in search order.
+	num_prefixes := 1 << k
+	best_values := make([]int, num_prefixes)
+	best_selections := make([][]bool, num_prefixes)
+	calls := make([]int, num_prefixes)
+	prefixes := make(chan int)
+	var done sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			worker_items := copy_items(items)
+			for p := range prefixes {
+				current_value := 0
+				current_weight := 0
+				for t := 0; t < k; t++ {
+					worker_items[t].is_selected = p&(1<<(k-1-t)) == 0
+					if worker_items[t].is_selected {
+						current_value += worker_items[t].value
+						current_weight += worker_items[t].weight
+					}
+				}
+				best_selections[p] = make([]bool, len(items))
+				best_values[p], calls[p] = do_exhaustive_search(worker_items, allowed_weight, k, current_value, current_weight, best_selections[p], -1)
+			}
+		}()
+	}
+	for p := 0; p < num_prefixes; p++ {
+		prefixes <- p
+	}
+	close(prefixes)
+	done.Wait()
+
+	// The serial search also visits the 2^k - 1 nodes above the prefixes.
+	best := 0
+	function_calls := num_prefixes - 1
+	for p := 0; p < num_prefixes; p++ {
+		if best_values[p] > best_values[best] {
+			best = p
+		}
+		function_calls += calls[p]
+	}
+	if best_values[best] < 0 {
+		return empty_solution(items), 0, function_calls
 	}
+	return apply_selection(items, best_selections[best]), best_values[best], function_calls
 }
 
-func rods_technique_sorted(items []Item, allowed_weight int) ([]Item, int, int) {
-	best_value := 0
+func branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
 	current_value := 0
 	current_weight := 0
 	remaing_value := 0
@@ -258,117 +813,4341 @@ func rods_technique_sorted(items []Item, allowed_weight int) ([]Item, int, int)
 		remaing_value += item.value
 	}
 
-	make_block_lists(items)
-	// Sort so items with longer blocked lists come first.
-	sort.Slice(items, func(i, j int) bool {
-		return len(items[i].block_list) > len(items[j].block_list)
-	})
+	// Nothing beats Dantzig's bound at the root, so the search can stop
+	// as soon as the incumbent reaches it.
+	root_bound := dantzig_bound(items, density_order(items), 0, allowed_weight)
 
-	// Reset the items' IDs.
-	for i := range items {
-		items[i].id = i
+	// Remember only which items the best selection has, and build the
+	// solution once at the end. The empty selection is the starting
+	// incumbent, so we always have a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	counts := new_depth_counts(len(items))
+	best_value, function_calls := do_branch_and_bound(items, allowed_weight, 0, best_selection, counts, 0, current_value, current_weight, remaing_value, root_bound)
+	stats := exact_stats(best_value, root_bound)
+	stats.depths = counts
+	return apply_selection(items, best_selection), best_value, function_calls, stats
+}
+
+// Return the statistics of an exact tree search that found best_value
+// under root_bound.
+func exact_stats(best_value, root_bound int) solver_stats {
+	if best_value >= root_bound {
+		return solver_stats{stop: met_root_bound, root_bound: root_bound}
 	}
+	return solver_stats{stop: searched_whole_tree, root_bound: root_bound}
+}
 
-	// Rebuild the blocked lists with the new indices.
-	make_block_lists(items)
+// Say why an exact search stopped: its incumbent met the root bound,
+// it ran out of nodes, or it ran out of time.
+func print_stop_reason(best_value int, stats solver_stats) {
+	switch stats.stop {
+	case met_root_bound:
+		fmt.Printf("Proven optimal: met the root bound %d\n", stats.root_bound)
+	case searched_whole_tree:
+		fmt.Printf("Proven optimal: searched the whole tree, root bound %d\n", stats.root_bound)
+	case time_limit_expired:
+		fmt.Printf("Time limit expired, upper bound: %d, gap: %d\n", stats.upper_bound, stats.upper_bound-best_value)
+	}
+}
 
-	return do_rods_technique(items, allowed_weight, 0, best_value, current_value, current_weight, remaing_value)
+// Nodes a tree search visited at each depth. The root is at depth 0 and
+// the leaves at len(items). Visited counts the nodes that decide an
+// item, pruned the visited nodes the bound cut off, and leaves the
+// complete selections, so the three never count the same node twice.
+type depth_counts struct {
+	visited []int
+	pruned  []int
+	leaves  []int
 }
 
-func make_block_lists(items []Item) {
-	for i, item := range items {
-		items[i].block_list = make([]int, 0)
-		for j, other_item := range items {
-			if i == j {
-				continue
-			}
-			if item.weight <= other_item.weight && item.value >= other_item.value {
-				items[i].block_list = append(items[i].block_list, items[j].id)
-			}
-		}
-	}
+func new_depth_counts(num_items int) *depth_counts {
+	return &depth_counts{make([]int, num_items+1), make([]int, num_items+1), make([]int, num_items+1)}
 }
 
-func block_items(source Item, items []Item) {
-	for _, blocked_by := range source.block_list {
-		if items[blocked_by].blocked_by == -1 {
-			items[blocked_by].blocked_by = source.id
+// Print the counts as a table with a row per depth that had any nodes,
+// and the totals.
+func print_depth_counts(counts *depth_counts) {
+	fmt.Printf("%5s %12s %12s %12s\n", "Depth", "Visited", "Pruned", "Leaves")
+	total_visited, total_pruned, total_leaves := 0, 0, 0
+	for depth := range counts.visited {
+		if counts.visited[depth] == 0 && counts.leaves[depth] == 0 {
+			continue
 		}
+		fmt.Printf("%5d %12d %12d %12d\n", depth, counts.visited[depth], counts.pruned[depth], counts.leaves[depth])
+		total_visited += counts.visited[depth]
+		total_pruned += counts.pruned[depth]
+		total_leaves += counts.leaves[depth]
 	}
+	fmt.Printf("%5s %12d %12d %12d\n", "Total", total_visited, total_pruned, total_leaves)
 }
 
-func unblock_items(source Item, items []Item) {
-	for _, blocked_by := range source.block_list {
-		if items[blocked_by].blocked_by == source.id {
-			items[blocked_by].blocked_by = -1
+// When a leaf beats best_value, record its selection in best_selection.
+// Count the nodes at each depth in counts.
+// Once best_value reaches root_bound, prune every other node.
+// Return the new best value and the number of function calls we made.
+func do_branch_and_bound(items []Item, allowed_weight, next_index int, best_selection []bool, counts *depth_counts, best_value, current_value, current_weight, remaing_value, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
 		}
+		counts.leaves[next_index]++
+		return best_value, 1
 	}
-}
 
-func getSliceOfSlices(r, c int) [][]int {
-	slice := make([][]int, r)
-	for i := range slice {
-		slice[i] = make([]int, c)
+	counts.visited[next_index]++
+	if best_value >= root_bound || current_value+remaing_value <= best_value {
+		counts.pruned[next_index]++
+		return best_value, 1
 	}
-	return slice
+
+	function_calls := 1
+	var calls int
+
+	if current_weight+items[next_index].weight <= allowed_weight {
+		items[next_index].is_selected = true
+		best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, counts, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value-items[next_index].value, root_bound)
+		function_calls += calls
+	}
+
+	items[next_index].is_selected = false
+	best_value, calls = do_branch_and_bound(items, allowed_weight, next_index+1, best_selection, counts, best_value, current_value, current_weight, remaing_value-items[next_index].value, root_bound)
+	return best_value, function_calls + calls
 }
 
-// Use dynamic programming to find a solution.
+// Use branch and bound with Dantzig's bound, deciding the items in the
+// given order:
+//   - density: densest first
+//   - weight-desc: heaviest first, since they are the hardest to fit
+//   - value-desc: most valuable first
+//   - bound-impact: of the bound_impact_candidates densest undecided
+//     items, the one whose take and skip bounds differ the most, so
+//     the branch that loses is likely pruned at once
+//
+// Every order finds the optimal value, but they can pick different
+// solutions of that value and visit very different numbers of nodes.
 // Return the best assignment, value of that assignment,
 // and the number of function calls we made.
-func dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
-	solution_value_array := getSliceOfSlices(len(items), allowed_weight+1)
-	prev_weight_array := getSliceOfSlices(len(items), allowed_weight+1)
-
-	//initialize first row
-	for i := 0; i < allowed_weight+1; i++ {
-		if items[0].weight <= i {
-			solution_value_array[0][i] = items[0].value
-			prev_weight_array[0][i] = -1
-		} else {
-			solution_value_array[0][i] = 0
-			prev_weight_array[0][i] = i
-		}
+func ordered_branch_and_bound(items []Item, allowed_weight int, branch_order string) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	sequence := density_order(items)
+	switch branch_order {
+	case "weight-desc":
+		sort.SliceStable(sequence, func(i, j int) bool {
+			return items[sequence[i]].weight > items[sequence[j]].weight
+		})
+	case "value-desc":
+		sort.SliceStable(sequence, func(i, j int) bool {
+			return items[sequence[i]].value > items[sequence[j]].value
+		})
 	}
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_ordered_branch_and_bound(items, density_order(items), sequence, branch_order,
+		make([]bool, len(items)), allowed_weight, 0, best_selection, -1, 0, 0)
+	// Only a negative allowed_weight leaves no leaf that fits.
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return apply_selection(items, best_selection), best_value, function_calls
+}
 
-	for i := 1; i < len(items); i++ {
-		for j := 0; j < allowed_weight+1; j++ {
-			//Calculate the value we get if item i is not in the solution.
-			value_without_item := solution_value_array[i-1][j]
-			//Calculate the value we get if item i is in the solution.
-			value_with_item := 0
-			if items[i].weight <= j {
-				value_with_item = solution_value_array[i-1][j-items[i].weight] + items[i].value
+// decided marks the items we have already decided on, and depth counts
+// them. When a leaf beats best_value, record its selection in
+// best_selection. Return the new best value and the number of function
+// calls we made.
+func do_ordered_branch_and_bound(items []Item, order, sequence []int, branch_order string, decided []bool, allowed_weight, depth int, best_selection []bool, best_value, current_value, current_weight int) (int, int) {
+	if current_weight > allowed_weight {
+		return best_value, 1
+	}
+	if depth >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+	if current_value+undecided_bound(items, order, decided, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	i := next_branch_item(items, order, sequence, branch_order, decided, allowed_weight-current_weight)
+	function_calls := 1
+	var calls int
+	decided[i] = true
+	if current_weight+items[i].weight <= allowed_weight {
+		items[i].is_selected = true
+		best_value, calls = do_ordered_branch_and_bound(items, order, sequence, branch_order, decided, allowed_weight, depth+1, best_selection, best_value,
+			current_value+items[i].value, current_weight+items[i].weight)
+		function_calls += calls
+		items[i].is_selected = false
+	}
+	best_value, calls = do_ordered_branch_and_bound(items, order, sequence, branch_order, decided, allowed_weight, depth+1, best_selection, best_value,
+		current_value, current_weight)
+	decided[i] = false
+	return best_value, function_calls + calls
+}
+
+// Like dantzig_bound, but pack the undecided items wherever they are.
+func undecided_bound(items []Item, order []int, decided []bool, remaining_weight int) int {
+	bound := 0
+	for _, i := range order {
+		if decided[i] {
+			continue
+		}
+		if items[i].weight <= remaining_weight {
+			bound += items[i].value
+			remaining_weight -= items[i].weight
+		} else {
+			if items[i].weight > 0 {
+				bound += items[i].value * remaining_weight / items[i].weight
+			}
+			break
+		}
+	}
+	return bound
+}
+
+// Return the undecided item to branch on next. The static orders take
+// the first undecided item in sequence. bound-impact compares the take
+// and skip bounds of the first bound_impact_candidates undecided items;
+// an item that doesn't fit has only one branch, so it goes first.
+func next_branch_item(items []Item, order, sequence []int, branch_order string, decided []bool, remaining_weight int) int {
+	best_item, best_impact, candidates := -1, -1, 0
+	for _, i := range sequence {
+		if decided[i] {
+			continue
+		}
+		if branch_order != "bound-impact" {
+			return i
+		}
+		if items[i].weight > remaining_weight {
+			return i
+		}
+		decided[i] = true
+		skip_bound := undecided_bound(items, order, decided, remaining_weight)
+		take_bound := items[i].value + undecided_bound(items, order, decided, remaining_weight-items[i].weight)
+		decided[i] = false
+		if impact := max(take_bound-skip_bound, skip_bound-take_bound); impact > best_impact {
+			best_item, best_impact = i, impact
+		}
+		candidates++
+		if candidates == bound_impact_candidates {
+			break
+		}
+	}
+	return best_item
+}
+
+// Estimate how many nodes branch_and_bound visits, with Knuth's random
+// probing. Each probe walks from the root to a leaf or a pruned node,
+// taking a random child among those the search would visit, and adds
+// up the products of the numbers of children along the way. Each
+// probe's sum is an unbiased estimate of the size of the tree the
+// search visits with a fixed incumbent. We prune with the same value
+// bound as branch_and_bound, and with estimate_incumbent as the
+// incumbent. The search starts lower and ends higher, so the two trees
+// differ, but usually by less than a factor of five either way.
+// Return the mean of the probes and its standard error.
+func estimate_tree_size(items []Item, allowed_weight, probes int, random *rand.Rand) (float64, float64) {
+	incumbent := estimate_incumbent(items, allowed_weight)
+	total_value := sum_values(items, true)
+
+	sum, sum_squares := 0.0, 0.0
+	for probe := 0; probe < probes; probe++ {
+		estimate, width := 0.0, 1.0
+		current_value, current_weight, remaing_value := 0, 0, total_value
+		for depth := 0; ; depth++ {
+			estimate += width
+			if depth == len(items) || current_value+remaing_value <= incumbent {
+				break
+			}
+			item := items[depth]
+			remaing_value -= item.value
+			// Leaving the item out is always possible.
+			if current_weight+item.weight <= allowed_weight {
+				width *= 2
+				if random.Intn(2) == 0 {
+					current_value += item.value
+					current_weight += item.weight
+				}
+			}
+		}
+		sum += estimate
+		sum_squares += estimate * estimate
+	}
+	mean := sum / float64(probes)
+	if probes < 2 {
+		return mean, 0
+	}
+	variance := (sum_squares - sum*mean) / float64(probes-1)
+	return mean, math.Sqrt(math.Max(variance, 0) / float64(probes))
+}
+
+// Return the incumbent estimate_tree_size prunes with: the better of
+// branch_and_bound's first leaf, which takes every item that fits in
+// order, and the greedy selection by density. The first leaf alone is
+// usually far from the optimum, which made the estimate thousands of
+// times too big. We don't stop when the incumbent reaches Dantzig's
+// bound at the root, as branch_and_bound does, since it only stops
+// once it has found such a selection itself.
+func estimate_incumbent(items []Item, allowed_weight int) int {
+	first_value, first_weight := 0, 0
+	for _, item := range items {
+		if first_weight+item.weight <= allowed_weight {
+			first_value += item.value
+			first_weight += item.weight
+		}
+	}
+	greedy := copy_items(items)
+	greedy_selection(greedy, allowed_weight)
+	return max(first_value, sum_values(greedy, false))
+}
+
+// Print the tree size estimate with a 95% confidence interval of 1.96
+// standard errors, and compare it with the calls branch_and_bound
+// made, if it ran (actual_calls >= 0).
+func run_estimate(items []Item, allowed_weight, actual_calls int) {
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	mean, std_err := estimate_tree_size(items, allowed_weight, estimate_probes, random)
+	fmt.Printf("Estimated nodes: %.4g ± %.2g (95%%: 1.96 standard errors, %d probes)\n", mean, 1.96*std_err, estimate_probes)
+	if actual_calls >= 0 {
+		fmt.Printf("Actual calls: %d, estimate / actual: %.2f\n", actual_calls, mean/float64(actual_calls))
+	}
+	fmt.Printf("Nodes in the full tree: %.4g\n", math.Exp2(float64(len(items)+1))-1)
+	fmt.Println()
+}
+
+func rods_technique(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	current_value := 0
+	current_weight := 0
+	remaing_value := 0
+	for _, item := range items {
+		remaing_value += item.value
+	}
+
+	make_block_lists(items)
+
+	root_bound := dantzig_bound(items, density_order(items), 0, allowed_weight)
+	best_selection := make([]bool, len(items))
+	counts := new_depth_counts(len(items))
+	best_value, function_calls := do_rods_technique(items, allowed_weight, 0, best_selection, counts, 0, current_value, current_weight, remaing_value, root_bound)
+	stats := exact_stats(best_value, root_bound)
+	stats.depths = counts
+	return apply_selection(items, best_selection), best_value, function_calls, stats
+}
+
+// Like do_branch_and_bound, but an item may only be selected if no
+// item that dominates it was left out. remaing_value only counts the
+// undecided items that aren't blocked, since blocked items can't add
+// anything.
+func do_rods_technique(items []Item, allowed_weight, next_index int, best_selection []bool, counts *depth_counts, best_value, current_value, current_weight, remaing_value, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		counts.leaves[next_index]++
+		return best_value, 1
+	}
+
+	counts.visited[next_index]++
+	if best_value >= root_bound || current_value+remaing_value <= best_value {
+		counts.pruned[next_index]++
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	// A blocked item's value was taken out of remaing_value when it was blocked.
+	if items[next_index].blocked_by == -1 {
+		remaing_value -= items[next_index].value
+		if current_weight+items[next_index].weight <= allowed_weight {
+			items[next_index].is_selected = true
+			best_value, calls = do_rods_technique(items, allowed_weight, next_index+1, best_selection, counts, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value, root_bound)
+			function_calls += calls
+		}
+	}
+
+	items[next_index].is_selected = false
+	blocked_value := block_items(next_index, items)
+	best_value, calls = do_rods_technique(items, allowed_weight, next_index+1, best_selection, counts, best_value, current_value, current_weight, remaing_value-blocked_value, root_bound)
+	unblock_items(next_index, items)
+	return best_value, function_calls + calls
+}
+
+func rods_technique_sorted(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	current_value := 0
+	current_weight := 0
+	remaing_value := 0
+	for _, item := range items {
+		remaing_value += item.value
+	}
+
+	sorted_items, order := sort_by_dominance(items)
+
+	root_bound := dantzig_bound(items, density_order(items), 0, allowed_weight)
+	// Search the sorted copy, then map the selection back to the
+	// caller's order.
+	best_selection := make([]bool, len(items))
+	counts := new_depth_counts(len(items))
+	best_value, function_calls := do_rods_technique(sorted_items, allowed_weight, 0, best_selection, counts, 0, current_value, current_weight, remaing_value, root_bound)
+	selection := make([]bool, len(items))
+	for k, i := range order {
+		selection[i] = best_selection[k]
+	}
+	stats := exact_stats(best_value, root_bound)
+	stats.depths = counts
+	return apply_selection(items, selection), best_value, function_calls, stats
+}
+
+// Return a copy of the items sorted so items that dominate more items
+// come first, with block lists for their new positions, and the order:
+// sorted item k is items[order[k]]. Sorting the positions lets us move
+// the dominance lists to the new positions instead of computing them
+// again.
+func sort_by_dominance(items []Item) ([]Item, []int) {
+	dominated := dominance_lists(items)
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return len(dominated[order[i]]) > len(dominated[order[j]])
+	})
+	new_position := make([]int, len(items))
+	for k, i := range order {
+		new_position[i] = k
+	}
+	sorted_items := make([]Item, len(items))
+	sorted_dominated := make([][]int, len(items))
+	for k, i := range order {
+		sorted_items[k] = items[i]
+		for _, j := range dominated[i] {
+			sorted_dominated[k] = append(sorted_dominated[k], new_position[j])
+		}
+	}
+	set_block_lists(sorted_items, sorted_dominated)
+	return sorted_items, order
+}
+
+// Like rods_technique_sorted, but split the search tree across workers
+// goroutines the way parallel_exhaustive_search does. Each worker keeps
+// its own copy of the items, since the blocked state changes as it
+// searches. The workers share one incumbent to prune with. A subtree
+// may still tie with an incumbent found under a later prefix, and we
+// keep the best selection of the earliest prefix, so the result is the
+// serial search's however the workers are scheduled. The number of
+// nodes visited does depend on the scheduling.
+// Return the best assignment, value of that assignment,
+// and the number of function calls the workers made below the prefixes.
+func parallel_rods_technique(items []Item, allowed_weight, workers int) ([]Item, int, int, solver_stats) {
+	if workers < 2 || len(items) == 0 || allowed_weight < 0 {
+		return rods_technique_sorted(items, allowed_weight)
+	}
+	sorted_items, order := sort_by_dominance(items)
+	root_bound := dantzig_bound(items, density_order(items), 0, allowed_weight)
+	total_value := sum_values(items, true)
+	k := 0
+	for 1<<k < 4*workers && k < len(items) {
+		k++
+	}
+
+	num_prefixes := 1 << k
+	best := &shared_incumbent{num_prefixes: num_prefixes}
+	best.key.Store(best.make_key(0, -1)) // The empty selection.
+	best_values := make([]int, num_prefixes)
+	best_selections := make([][]bool, num_prefixes)
+	calls := make([]int, num_prefixes)
+	prefixes := make(chan int)
+	var done sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			worker_items := copy_items(sorted_items)
+			for p := range prefixes {
+				best_selections[p] = make([]bool, len(items))
+				best_values[p], calls[p] = do_rods_prefix(worker_items, allowed_weight, k, p, best_selections[p], total_value, root_bound, best)
+			}
+		}()
+	}
+	for p := 0; p < num_prefixes; p++ {
+		prefixes <- p
+	}
+	close(prefixes)
+	done.Wait()
+
+	best_prefix := -1
+	best_value := 0
+	function_calls := 0
+	for p := 0; p < num_prefixes; p++ {
+		if best_values[p] > best_value {
+			best_prefix = p
+			best_value = best_values[p]
+		}
+		function_calls += calls[p]
+	}
+	selection := make([]bool, len(items))
+	if best_prefix >= 0 {
+		for k, i := range order {
+			selection[i] = best_selections[best_prefix][k]
+		}
+	}
+	return apply_selection(items, selection), best_value, function_calls, exact_stats(best_value, root_bound)
+}
+
+// The incumbent the workers of parallel_rods_technique share: its value
+// and the prefix it was found under, packed into one key so both can
+// be read and updated atomically. A bigger key is a better incumbent,
+// with a higher value or an equal value under an earlier prefix.
+type shared_incumbent struct {
+	key          atomic.Int64
+	num_prefixes int
+}
+
+// Return the key of value found under prefix. Prefix -1 comes before
+// all the others.
+func (best *shared_incumbent) make_key(value, prefix int) int64 {
+	return int64(value)*int64(best.num_prefixes+1) + int64(best.num_prefixes-1-prefix)
+}
+
+// Make value, found under prefix, the incumbent if it's better.
+func (best *shared_incumbent) offer(value, prefix int) {
+	key := best.make_key(value, prefix)
+	for {
+		old := best.key.Load()
+		if key <= old || best.key.CompareAndSwap(old, key) {
+			return
+		}
+	}
+}
+
+// Return true if a subtree under prefix that is worth at most bound
+// can't give the selection we keep: it can't beat the incumbent, and
+// can only tie it if the incumbent comes from this or an earlier prefix.
+func (best *shared_incumbent) prunes(bound, prefix int) bool {
+	return best.make_key(bound, prefix) <= best.key.Load()
+}
+
+// Make the decisions of prefix on the first k items the way
+// do_rods_technique would, search below them if they're allowed, and
+// undo them. remaing_value is the total value of the items.
+// Return the best value under the prefix and the number of function
+// calls we made.
+func do_rods_prefix(items []Item, allowed_weight, k, prefix int, best_selection []bool, remaing_value, root_bound int, best *shared_incumbent) (int, int) {
+	current_value := 0
+	current_weight := 0
+	t := 0
+	for ; t < k; t++ {
+		take := prefix&(1<<(k-1-t)) == 0
+		if take && (items[t].blocked_by != -1 || current_weight+items[t].weight > allowed_weight) {
+			break
+		}
+		if items[t].blocked_by == -1 {
+			remaing_value -= items[t].value
+		}
+		items[t].is_selected = take
+		if take {
+			current_value += items[t].value
+			current_weight += items[t].weight
+		} else {
+			remaing_value -= block_items(t, items)
+		}
+	}
+
+	best_value, function_calls := 0, 0
+	if t == k {
+		best_value, function_calls = do_parallel_rods_technique(items, allowed_weight, k, prefix, best_selection, 0, current_value, current_weight, remaing_value, root_bound, best)
+	}
+
+	for t--; t >= 0; t-- {
+		if !items[t].is_selected {
+			unblock_items(t, items)
+		}
+		items[t].is_selected = false
+	}
+	return best_value, function_calls
+}
+
+// Like do_rods_technique, but prune against the shared incumbent.
+func do_parallel_rods_technique(items []Item, allowed_weight, next_index, prefix int, best_selection []bool, best_value, current_value, current_weight, remaing_value, root_bound int, best *shared_incumbent) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+			best.offer(current_value, prefix)
+		}
+		return best_value, 1
+	}
+
+	bound := current_value + remaing_value
+	if root_bound < bound {
+		bound = root_bound
+	}
+	if best.prunes(bound, prefix) {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	// A blocked item's value was taken out of remaing_value when it was blocked.
+	if items[next_index].blocked_by == -1 {
+		remaing_value -= items[next_index].value
+		if current_weight+items[next_index].weight <= allowed_weight {
+			items[next_index].is_selected = true
+			best_value, calls = do_parallel_rods_technique(items, allowed_weight, next_index+1, prefix, best_selection, best_value, current_value+items[next_index].value, current_weight+items[next_index].weight, remaing_value, root_bound, best)
+			function_calls += calls
+		}
+	}
+
+	items[next_index].is_selected = false
+	blocked_value := block_items(next_index, items)
+	best_value, calls = do_parallel_rods_technique(items, allowed_weight, next_index+1, prefix, best_selection, best_value, current_value, current_weight, remaing_value-blocked_value, root_bound, best)
+	unblock_items(next_index, items)
+	return best_value, function_calls + calls
+}
+
+// Give each item the block list of the later items it dominates.
+func make_block_lists(items []Item) {
+	set_block_lists(items, dominance_lists(items))
+}
+
+// Make each item's block list the positions in its dominance list that
+// come after it. By the time an earlier item is blocked it has already
+// been decided, so blocking it would only cost time.
+func set_block_lists(items []Item, dominated [][]int) {
+	for i := range items {
+		items[i].block_list = make([]int, 0)
+		for _, j := range dominated[i] {
+			if j > i {
+				items[i].block_list = append(items[i].block_list, j)
+			}
+		}
+	}
+}
+
+// Return, for each item, the positions of the items it dominates.
+// Of two identical items, only the earlier one dominates the other,
+// so they can't block each other.
+// Sweep the items by increasing weight, then decreasing value, then
+// position: everything an item dominates comes after it in that order,
+// so we only need to compare it with the items that follow.
+func dominance_lists(items []Item) [][]int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := items[order[i]], items[order[j]]
+		if a.weight != b.weight {
+			return a.weight < b.weight
+		}
+		if a.value != b.value {
+			return a.value > b.value
+		}
+		return order[i] < order[j]
+	})
+
+	dominated := make([][]int, len(items))
+	for k, i := range order {
+		for _, j := range order[k+1:] {
+			if items[j].value <= items[i].value {
+				dominated[i] = append(dominated[i], j)
+			}
+		}
+	}
+	return dominated
+}
+
+// Block the items in the block list of the item at position source.
+// Block lists and blocked_by hold positions, not ids, so the ids can be anything.
+// Return the total value of the undecided items after source we blocked.
+func block_items(source int, items []Item) int {
+	blocked_value := 0
+	for _, blocked := range items[source].block_list {
+		if items[blocked].blocked_by == -1 {
+			items[blocked].blocked_by = source
+			if blocked > source {
+				blocked_value += items[blocked].value
+			}
+		}
+	}
+	return blocked_value
+}
+
+// Unblock the items that the item at position source blocked.
+func unblock_items(source int, items []Item) {
+	for _, blocked := range items[source].block_list {
+		if items[blocked].blocked_by == source {
+			items[blocked].blocked_by = -1
+		}
+	}
+}
+
+// Return an r by c table whose rows share one backing array,
+// so the whole table is a single allocation and rows sit next to
+// each other in memory.
+func getSliceOfSlices(r, c int) [][]int {
+	cells := make([]int, r*c)
+	slice := make([][]int, r)
+	for i := range slice {
+		slice[i] = cells[i*c : (i+1)*c : (i+1)*c]
+	}
+	return slice
+}
+
+// Like getSliceOfSlices, but for a table of bools.
+func getBoolSliceOfSlices(r, c int) [][]bool {
+	cells := make([]bool, r*c)
+	slice := make([][]bool, r)
+	for i := range slice {
+		slice[i] = cells[i*c : (i+1)*c : (i+1)*c]
+	}
+	return slice
+}
+
+// Use dynamic programming to find a solution.
+// If the table would have more than max_dp_cells cells, we use
+// value_dynamic_programming instead; call check_dynamic_programming_size
+// first in case that table is too big as well.
+// took_array[i][j] records whether item i is in the best solution of the
+// first i+1 items within weight j. We can't tell that from the weights
+// alone: a zero-weight item leaves the weight unchanged either way.
+// Zero-weight items with positive value are always selected, and
+// zero-value items never are, since they add nothing.
+// The items are left unchanged.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
+	if len(items) == 0 || allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	// With a huge capacity, index the table by value instead.
+	if float64(len(items))*(float64(allowed_weight)+1) > max_dp_cells {
+		return value_dynamic_programming(items, allowed_weight)
+	}
+
+	solution_value_array := getSliceOfSlices(len(items), allowed_weight+1)
+	took_array := getBoolSliceOfSlices(len(items), allowed_weight+1)
+	for i := range items {
+		fill_dynamic_programming_row(items, i, 0, allowed_weight+1, solution_value_array, took_array)
+	}
+
+	//Find the items in the solution, in a copy so the caller's items stay as they were.
+	solution := empty_solution(items)
+	select_took_items(solution, took_array, allowed_weight)
+	return solution, sum_values(solution, false), len(items) * (allowed_weight + 1)
+}
+
+// Fill the cells first <= j < last of row i of dynamic_programming's
+// tables. Row i only reads row i-1, and row 0 acts as if the row
+// before it were all zeros.
+func fill_dynamic_programming_row(items []Item, i, first, last int, solution_value_array [][]int, took_array [][]bool) {
+	for j := first; j < last; j++ {
+		//Calculate the value we get if item i is not in the solution.
+		value_without_item := 0
+		if i > 0 {
+			value_without_item = solution_value_array[i-1][j]
+		}
+		//Calculate the value we get if item i is in the solution.
+		value_with_item := 0
+		if items[i].weight <= j {
+			value_with_item = items[i].value
+			if i > 0 {
+				value_with_item += solution_value_array[i-1][j-items[i].weight]
+			}
+		}
+		//Choose the better of the two values.
+		if value_with_item > value_without_item {
+			solution_value_array[i][j] = value_with_item
+			took_array[i][j] = true
+		} else {
+			solution_value_array[i][j] = value_without_item
+			took_array[i][j] = false
+		}
+	}
+}
+
+// Walk took_array back from the last item and allowed_weight,
+// selecting the items the best solution took.
+func select_took_items(items []Item, took_array [][]bool, allowed_weight int) {
+	j := allowed_weight
+	for i := len(items) - 1; i >= 0; i-- {
+		if took_array[i][j] {
+			items[i].is_selected = true
+			j -= items[i].weight
+		}
+	}
+}
+
+// Like dynamic_programming, but split each row's capacities into one
+// chunk per worker and fill the chunks in parallel. Each row only reads
+// the row before it, so the chunks don't depend on each other; the
+// workers just wait for each other after every row. The same goroutines
+// fill every row. Tables smaller than parallel_dp_min_cells don't repay
+// the overhead, so they go to dynamic_programming, as do tables too big
+// for it to index by weight.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func parallel_dynamic_programming(items []Item, allowed_weight, workers int) ([]Item, int, int) {
+	num_cells := float64(len(items)) * (float64(allowed_weight) + 1)
+	if workers < 2 || len(items) == 0 || allowed_weight < 0 ||
+		num_cells < parallel_dp_min_cells || num_cells > max_dp_cells {
+		return dynamic_programming(items, allowed_weight)
+	}
+	if workers > allowed_weight+1 {
+		workers = allowed_weight + 1
+	}
+
+	solution_value_array := getSliceOfSlices(len(items), allowed_weight+1)
+	took_array := getBoolSliceOfSlices(len(items), allowed_weight+1)
+
+	// Send each worker the row to fill, then wait until they're all done
+	// before sending the next one.
+	chunk := (allowed_weight + workers) / workers
+	rows := make([]chan int, workers)
+	var row_done sync.WaitGroup
+	for w := range rows {
+		rows[w] = make(chan int)
+		first := w * chunk
+		last := first + chunk
+		if last > allowed_weight+1 {
+			last = allowed_weight + 1
+		}
+		go func(row <-chan int) {
+			for i := range row {
+				fill_dynamic_programming_row(items, i, first, last, solution_value_array, took_array)
+				row_done.Done()
+			}
+		}(rows[w])
+	}
+	for i := range items {
+		row_done.Add(workers)
+		for _, row := range rows {
+			row <- i
+		}
+		row_done.Wait()
+	}
+	for _, row := range rows {
+		close(row)
+	}
+
+	solution := empty_solution(items)
+	select_took_items(solution, took_array, allowed_weight)
+	return solution, sum_values(solution, false), len(items) * (allowed_weight + 1)
+}
+
+// Find the best value within allowed_weight while reading each item of
+// the source once, keeping only one row of the table: best[w] is the
+// best value of the items so far within weight w. Going down the
+// weights lets us update the row in place without using an item twice.
+// Without the whole table we can't tell which items are selected.
+// Return the best value and the number of table cells we computed.
+func streamed_dynamic_programming(source item_source, allowed_weight int) (int, int) {
+	if allowed_weight < 0 {
+		return 0, 0
+	}
+	best := make([]int, allowed_weight+1)
+	cells := 0
+	for item, ok := source.next(); ok; item, ok = source.next() {
+		for w := allowed_weight; w >= item.weight; w-- {
+			if best[w-item.weight]+item.value > best[w] {
+				best[w] = best[w-item.weight] + item.value
+			}
+		}
+		cells += allowed_weight + 1
+	}
+	return best[allowed_weight], cells
+}
+
+func run_streamed(source item_source, allowed_weight, optimum int) {
+	start := time.Now()
+
+	// Run the algorithm.
+	total_value, cells := streamed_dynamic_programming(source, allowed_weight)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	fmt.Printf("Value: %d, Calls: %d\n", total_value, cells)
+	if optimum >= 0 && total_value != optimum {
+		fmt.Printf("*** MISMATCH: the optimum is %d ***\n", optimum)
+		verification_failed = true
+	}
+	fmt.Println()
+}
+
+// Explain why the item at position index is or isn't in the solution,
+// which must be optimal. To see what the item would cost, solve again
+// with it forced in: the other items get the capacity it leaves. If a
+// selected item dominates it, name that item too.
+func explain_item(solution []Item, allowed_weight, index int) string {
+	item := solution[index]
+	name := fmt.Sprintf("Item %d(%d, %d)", index, item.value, item.weight)
+	if item.is_selected {
+		return name + " is selected"
+	}
+	if item.weight > allowed_weight {
+		return fmt.Sprintf("%s weighs more than the capacity %d", name, allowed_weight)
+	}
+	others := append(copy_items(solution[:index]), solution[index+1:]...)
+	_, others_value, _ := dynamic_programming(others, allowed_weight-item.weight)
+	cost := sum_values(solution, false) - others_value - item.value
+	if cost == 0 {
+		return name + " could be selected too: forcing it in gives another optimal solution"
+	}
+	for j, dominated := range dominance_lists(solution) {
+		if solution[j].is_selected && slices.Contains(dominated, index) {
+			return fmt.Sprintf("%s is dominated by item %d(%d, %d), which is selected; forcing it in costs %d value",
+				name, j, solution[j].value, solution[j].weight, cost)
+		}
+	}
+	return fmt.Sprintf("%s doesn't pay for its weight; forcing it in costs %d value", name, cost)
+}
+
+// Why the items a solution leaves out were left out. Every left-out
+// item is counted in exactly one of dominated, too_heavy, close_calls
+// and missed.
+type solution_summary struct {
+	left_out    int
+	dominated   int // Dominated by a selected item.
+	too_heavy   int // Don't fit the residual capacity.
+	close_calls int // Would fit, but are less dense than the marginal item.
+	missed      int // Would fit and are at least as dense. Only a solution that isn't optimal has them.
+	slack       int // Capacity the selected items leave unused.
+	marginal    int // Position of the least dense selected item, or -1.
+}
+
+// Sort the items the solution leaves out into the summary's buckets.
+// The residual capacity is the slack. The marginal item is the selected
+// item with the lowest density, the first one to give up for something
+// else.
+func summarize_solution(solution []Item, allowed_weight int) solution_summary {
+	summary := solution_summary{slack: allowed_weight - sum_weights(solution, false), marginal: -1}
+	for i, item := range solution {
+		if item.is_selected && (summary.marginal < 0 || density(item) < density(solution[summary.marginal])) {
+			summary.marginal = i
+		}
+	}
+
+	is_dominated := make([]bool, len(solution))
+	for j, dominated := range dominance_lists(solution) {
+		if solution[j].is_selected {
+			for _, i := range dominated {
+				is_dominated[i] = true
+			}
+		}
+	}
+	for i, item := range solution {
+		if item.is_selected {
+			continue
+		}
+		summary.left_out++
+		switch {
+		case is_dominated[i]:
+			summary.dominated++
+		case item.weight > summary.slack:
+			summary.too_heavy++
+		case summary.marginal >= 0 && density(item) < density(solution[summary.marginal]):
+			summary.close_calls++
+		default:
+			summary.missed++
+		}
+	}
+	return summary
+}
+
+func print_summary(solution []Item, summary solution_summary) {
+	fmt.Printf("Left out %d: %d dominated, %d don't fit the residual capacity, %d close calls\n",
+		summary.left_out, summary.dominated, summary.too_heavy, summary.close_calls)
+	if summary.missed > 0 {
+		fmt.Printf("%d would fit and are at least as dense as the marginal item\n", summary.missed)
+	}
+	if summary.marginal >= 0 {
+		item := solution[summary.marginal]
+		fmt.Printf("Slack %d, marginal item %d(%d, %d) with density %.2f\n",
+			summary.slack, summary.marginal, item.value, item.weight, density(item))
+	} else {
+		fmt.Printf("Slack %d, nothing selected\n", summary.slack)
+	}
+}
+
+// Find a near-optimal solution when the capacity is too big for the
+// exact table: solve with every weight divided by k and rounded up, and
+// the capacity divided by k and rounded down, for a table about k times
+// smaller. Rounding up keeps the solution feasible, since its real
+// weight is at most k times its scaled weight. The rounding wastes less
+// than k units of capacity per selected item, plus allowed_weight % k,
+// so we then fill the capacity that is left with an exact dynamic
+// program over the other items. We report k times the number of items
+// the scaled solution selects as the bound on the value lost.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func scaled_dynamic_programming(items []Item, allowed_weight, k int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	if allowed_weight < 0 || k < 1 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	scaled_items := copy_items(items)
+	for i := range scaled_items {
+		scaled_items[i].weight = (items[i].weight + k - 1) / k
+	}
+	scaled_solution, scaled_value, cells := dynamic_programming(scaled_items, allowed_weight/k)
+	for i := range items {
+		items[i].is_selected = scaled_solution[i].is_selected
+	}
+	num_selected := count_selected(items)
+
+	// Fill what's left exactly with the items the scaled solution left out.
+	var others []int
+	for i := range items {
+		if !items[i].is_selected {
+			others = append(others, i)
+		}
+	}
+	other_items := make([]Item, len(others))
+	for j, i := range others {
+		other_items[j] = items[i]
+	}
+	left_over := allowed_weight - sum_weights(items, false)
+	fill, fill_value, fill_cells := dynamic_programming(other_items, left_over)
+	for j, i := range others {
+		items[i].is_selected = fill[j].is_selected
+	}
+	details := []string{fmt.Sprintf("Scaled value: %d, refined: %d, loss bound: k × %d selected items",
+		scaled_value, scaled_value+fill_value, num_selected)}
+	stats := solver_stats{details: details, has_loss: true, loss_bound: k * num_selected}
+	return items, scaled_value + fill_value, cells + fill_cells, stats
+}
+
+// Return an error if both the weight-indexed and the value-indexed
+// dynamic programming tables would have more than max_dp_cells cells.
+func check_dynamic_programming_size(items []Item, allowed_weight int) error {
+	weight_cells := float64(len(items)) * (float64(allowed_weight) + 1)
+	value_cells := float64(len(items)) * (float64(sum_values(items, true)) + 1)
+	if weight_cells > max_dp_cells && value_cells > max_dp_cells {
+		return fmt.Errorf("the table would need %.0f cells by weight or %.0f by value, more than the limit of %d; "+
+			"try branch and bound or a heuristic instead", weight_cells, value_cells, max_dp_cells)
+	}
+	return nil
+}
+
+// Use dynamic programming over values instead of weights, which pays
+// off when the capacity is much larger than the total value: find the
+// most valuable value whose lightest selection fits.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func value_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	min_weight_array := min_weight_table(items)
+	last := min_weight_array[len(items)]
+	best_value := 0
+	for v := range last {
+		if last[v] <= allowed_weight {
+			best_value = v
+		}
+	}
+
+	solution := copy_items(items)
+	select_min_weight(solution, min_weight_array, best_value)
+	return solution, best_value, len(items) * len(last)
+}
+
+// Repeatedly make the best improving move until none is left.
+// A move either adds an unselected item that still fits or
+// swaps one selected item for one unselected item.
+// Return the number of moves we examined.
+func exchange_local_search(items []Item, allowed_weight int) int {
+	moves := 0
+	current_weight := sum_weights(items, false)
+	for {
+		best_gain := 0
+		best_out := -1
+		best_in := -1
+		for j := range items {
+			if items[j].is_selected {
+				continue
+			}
+			// Try adding item j.
+			moves++
+			if current_weight+items[j].weight <= allowed_weight && items[j].value > best_gain {
+				best_gain = items[j].value
+				best_out, best_in = -1, j
+			}
+			// Try swapping item j for a selected item i.
+			for i := range items {
+				if !items[i].is_selected {
+					continue
+				}
+				moves++
+				gain := items[j].value - items[i].value
+				if current_weight-items[i].weight+items[j].weight <= allowed_weight && gain > best_gain {
+					best_gain = gain
+					best_out, best_in = i, j
+				}
+			}
+		}
+
+		// Stop at a local optimum.
+		if best_in == -1 {
+			return moves
+		}
+		if best_out != -1 {
+			items[best_out].is_selected = false
+			current_weight -= items[best_out].weight
+		}
+		items[best_in].is_selected = true
+		current_weight += items[best_in].weight
+	}
+}
+
+// Select a random feasible set of items.
+func random_selection(items []Item, allowed_weight int, random *rand.Rand) {
+	current_weight := 0
+	for i := range items {
+		items[i].is_selected = false
+	}
+	for _, i := range random.Perm(len(items)) {
+		if random.Intn(2) == 0 && current_weight+items[i].weight <= allowed_weight {
+			items[i].is_selected = true
+			current_weight += items[i].weight
+		}
+	}
+}
+
+// Use hill climbing with random restarts to find a solution.
+// Return the best local optimum, value of that solution,
+// and the number of moves we examined.
+func hill_climbing(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	best_items, best_value, moves, local_values := do_hill_climbing(items, allowed_weight, num_restarts, random)
+
+	// Show how the local optima are distributed.
+	sort.Ints(local_values)
+	details := []string{fmt.Sprintf("Local optima: min %d, median %d, max %d",
+		local_values[0], local_values[len(local_values)/2], local_values[len(local_values)-1])}
+	return best_items, best_value, moves, solver_stats{unit: "Moves", details: details}
+}
+
+// Climb from num_restarts random starting points.
+// Also return the value of every local optimum we reached.
+func do_hill_climbing(items []Item, allowed_weight, num_restarts int, random *rand.Rand) ([]Item, int, int, []int) {
+	// The empty selection is the starting incumbent, so we return a
+	// solution even without restarts.
+	best_items := empty_solution(items)
+	best_value := 0
+	moves := 0
+	local_values := make([]int, 0, num_restarts)
+	for r := 0; r < num_restarts; r++ {
+		random_selection(items, allowed_weight, random)
+		moves += exchange_local_search(items, allowed_weight)
+
+		value := sum_values(items, false)
+		local_values = append(local_values, value)
+		if value > best_value {
+			best_items = copy_items(items)
+			best_value = value
+		}
+	}
+	return best_items, best_value, moves, local_values
+}
+
+// Return the items' indices sorted by decreasing value per unit of weight.
+func density_order(items []Item) []int {
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return density(items[order[i]]) > density(items[order[j]])
+	})
+	return order
+}
+
+// Return the item's value per unit of weight. Free items with value
+// come first and free items without value count as worthless.
+func density(item Item) float64 {
+	if item.weight == 0 {
+		if item.value > 0 {
+			return math.Inf(1)
+		}
+		return 0
+	}
+	return float64(item.value) / float64(item.weight)
+}
+
+// Return an optimistic bound on the value we can still add with
+// items[next_index:] and the remaining capacity. Items are packed by
+// density, all copies at a time, and the first one that doesn't fit
+// contributes a fraction of its value (Dantzig's bound).
+func dantzig_bound(items []Item, order []int, next_index, remaining_weight int) int {
+	bound := 0
+	for _, i := range order {
+		if i < next_index {
+			continue
+		}
+		if items[i].weight*items[i].quantity <= remaining_weight {
+			bound += items[i].value * items[i].quantity
+			remaining_weight -= items[i].weight * items[i].quantity
+		} else {
+			// A free item only fails to fit when the capacity is already negative.
+			if items[i].weight > 0 {
+				bound += items[i].value * remaining_weight / items[i].weight
+			}
+			break
+		}
+	}
+	return bound
+}
+
+// A partial solution that decides the items before some depth.
+type beam_state struct {
+	selected             []bool
+	value, weight, bound int
+}
+
+// Use beam search to find a solution.
+// Return the best assignment, value of that assignment,
+// and the number of states we expanded.
+func beam_search(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	best_items, best_value, expanded, discarded := do_beam_search(items, allowed_weight, beam_width)
+	details := []string{fmt.Sprintf("Discarded: %d", discarded)}
+	return best_items, best_value, expanded, solver_stats{unit: "Expanded", details: details}
+}
+
+// Expand the states one item at a time, keeping only the beam_width
+// states with the best value plus Dantzig bound at each depth.
+// Also return the number of states dropped because of the beam limit.
+func do_beam_search(items []Item, allowed_weight, beam_width int) ([]Item, int, int, int) {
+	order := density_order(items)
+	states := []beam_state{{make([]bool, len(items)), 0, 0, 0}}
+	expanded := 0
+	discarded := 0
+	for depth := range items {
+		children := make([]beam_state, 0, 2*len(states))
+		for _, state := range states {
+			expanded++
+
+			// Take the item if it fits.
+			if state.weight+items[depth].weight <= allowed_weight {
+				child := beam_state{make([]bool, len(items)),
+					state.value + items[depth].value, state.weight + items[depth].weight, 0}
+				copy(child.selected, state.selected)
+				child.selected[depth] = true
+				child.bound = child.value + dantzig_bound(items, order, depth+1, allowed_weight-child.weight)
+				children = append(children, child)
+			}
+
+			// Skip the item.
+			child := beam_state{state.selected, state.value, state.weight, 0}
+			child.bound = child.value + dantzig_bound(items, order, depth+1, allowed_weight-child.weight)
+			children = append(children, child)
+		}
+
+		// Keep the most promising states.
+		sort.SliceStable(children, func(i, j int) bool {
+			return children[i].bound > children[j].bound
+		})
+		if beam_width > 0 && len(children) > beam_width {
+			discarded += len(children) - beam_width
+			children = children[:beam_width]
+		}
+		states = children
+	}
+
+	// Every remaining state is a feasible leaf. Pick the best one.
+	best := states[0]
+	for _, state := range states {
+		if state.value > best.value {
+			best = state
+		}
+	}
+	for i := range items {
+		items[i].is_selected = best.selected[i]
+	}
+	return copy_items(items), best.value, expanded, discarded
+}
+
+// Use GRASP (greedy randomized adaptive search) to find a solution.
+// Return the best assignment, value of that assignment,
+// and the number of moves the local search examined.
+func grasp(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	best_items, best_value, moves, best_iteration, mean_constructed :=
+		do_grasp(items, allowed_weight, grasp_alpha, grasp_iterations, random)
+	details := []string{fmt.Sprintf("Best iteration: %d, Mean constructed value: %.2f", best_iteration, mean_constructed)}
+	return best_items, best_value, moves, solver_stats{unit: "Moves", details: details}
+}
+
+// Build iterations randomized greedy solutions, improve each with the
+// exchange local search, and keep the best. Also return the iteration
+// that found the best solution and the mean value of the constructed
+// solutions before improvement.
+func do_grasp(items []Item, allowed_weight int, alpha float64, iterations int, random *rand.Rand) ([]Item, int, int, int, float64) {
+	order := density_order(items)
+	// The empty selection is the starting incumbent, so we return a
+	// solution even without iterations.
+	best_items := empty_solution(items)
+	best_value := 0
+	best_iteration := -1
+	moves := 0
+	constructed_total := 0
+	for iteration := 0; iteration < iterations; iteration++ {
+		for i := range items {
+			items[i].is_selected = false
+		}
+
+		// Add random items from the densest ones that still fit.
+		current_weight := 0
+		for {
+			candidates := make([]int, 0, len(items))
+			for _, i := range order {
+				if !items[i].is_selected && current_weight+items[i].weight <= allowed_weight {
+					candidates = append(candidates, i)
+				}
+			}
+			if len(candidates) == 0 {
+				break
+			}
+			num_restricted := int(math.Ceil(alpha * float64(len(candidates))))
+			if num_restricted < 1 {
+				num_restricted = 1
+			}
+			i := candidates[random.Intn(num_restricted)]
+			items[i].is_selected = true
+			current_weight += items[i].weight
+		}
+		constructed_total += sum_values(items, false)
+
+		moves += exchange_local_search(items, allowed_weight)
+		value := sum_values(items, false)
+		if value > best_value {
+			best_items = copy_items(items)
+			best_value = value
+			best_iteration = iteration
+		}
+	}
+	return best_items, best_value, moves, best_iteration, float64(constructed_total) / float64(iterations)
+}
+
+// Solve the LP relaxation: pack items by density and take a fraction
+// of the first one that doesn't fit. Return each item's fraction.
+func fractional_knapsack(items []Item, allowed_weight int) []float64 {
+	fractions := make([]float64, len(items))
+	remaining_weight := allowed_weight
+	for _, i := range density_order(items) {
+		if items[i].weight <= remaining_weight {
+			fractions[i] = 1
+			remaining_weight -= items[i].weight
+		} else {
+			fractions[i] = float64(remaining_weight) / float64(items[i].weight)
+			break
+		}
+	}
+	return fractions
+}
+
+// Use randomized rounding of the LP relaxation to find a solution.
+// Return the best assignment, value of that assignment,
+// and the number of trials we made.
+func randomized_rounding(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	best_items, best_value, mean_value := do_randomized_rounding(items, allowed_weight, rounding_trials, random)
+	details := []string{fmt.Sprintf("Mean trial value: %.2f", mean_value)}
+	return best_items, best_value, rounding_trials, solver_stats{unit: "Trials", details: details}
+}
+
+// Select each item with probability equal to its LP fraction, then drop
+// the least dense selected items until the selection fits. Repeat for
+// the given number of trials and keep the best. Also return the mean
+// value of the trials.
+func do_randomized_rounding(items []Item, allowed_weight, trials int, random *rand.Rand) ([]Item, int, float64) {
+	fractions := fractional_knapsack(items, allowed_weight)
+	order := density_order(items)
+	// The empty selection is the starting incumbent, so we return a
+	// solution even without trials.
+	best_items := empty_solution(items)
+	best_value := 0
+	total_value := 0
+	for trial := 0; trial < trials; trial++ {
+		current_weight := 0
+		for i := range items {
+			items[i].is_selected = random.Float64() < fractions[i]
+			if items[i].is_selected {
+				current_weight += items[i].weight
+			}
+		}
+
+		// Repair the selection, least dense items first.
+		for k := len(order) - 1; k >= 0 && current_weight > allowed_weight; k-- {
+			if items[order[k]].is_selected {
+				items[order[k]].is_selected = false
+				current_weight -= items[order[k]].weight
+			}
+		}
+
+		value := sum_values(items, false)
+		total_value += value
+		if value > best_value {
+			best_items = copy_items(items)
+			best_value = value
+		}
+	}
+	return best_items, best_value, float64(total_value) / float64(trials)
+}
+
+// Select items by decreasing density while they fit.
+func greedy_selection(items []Item, allowed_weight int) {
+	current_weight := 0
+	for i := range items {
+		items[i].is_selected = false
+	}
+	for _, i := range density_order(items) {
+		if current_weight+items[i].weight <= allowed_weight {
+			items[i].is_selected = true
+			current_weight += items[i].weight
+		}
+	}
+}
+
+// A new incumbent value and how long after the start it was found.
+type trajectory_point struct {
+	elapsed time.Duration
+	value   int
+}
+
+// The best solution found so far by the anytime branch and bound.
+type incumbent struct {
+	selected   []bool
+	value      int
+	trajectory []trajectory_point // Every value the incumbent has had, in order.
+	nodes      int
+	now        func() time.Time // The clock, so runs can be replayed with a fake one.
+	start      time.Time
+	deadline   time.Time
+	expired    bool
+	root_bound int // The search stops once value reaches it.
+}
+
+// Make value the new incumbent and record when it was found.
+func (best *incumbent) improve(value int, selected []bool) {
+	best.value = value
+	copy(best.selected, selected)
+	best.trajectory = append(best.trajectory, trajectory_point{best.now().Sub(best.start), value})
+}
+
+// Find a good solution with greedy plus exchange local search, then use
+// it as the starting lower bound of a branch and bound with Dantzig's
+// bound to prove it optimal or improve it. Items whose reduced cost
+// shows they can't change in a better solution are fixed before the
+// search.
+// Return the best assignment, value of that assignment,
+// and the number of nodes the branch and bound visited.
+func auto_exact(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	root_bound := sorted_bound(items, density_order(items), 0, allowed_weight)
+	best_items, best_value, nodes, proven, upper_bound, trajectory, num_fixed :=
+		do_auto_exact(items, allowed_weight, root_bound, auto_exact_time_limit, time.Now)
+
+	incumbents := "Incumbents:"
+	for _, point := range trajectory {
+		incumbents += fmt.Sprintf(" %d at %fs", point.value, point.elapsed.Seconds())
+	}
+	stats := exact_stats(best_value, root_bound)
+	if !proven {
+		stats = solver_stats{stop: time_limit_expired, upper_bound: upper_bound}
+	}
+	stats.details = []string{fmt.Sprintf("Fixed by reduced cost: %d of %d items", num_fixed, len(items)), incumbents}
+	return best_items, best_value, nodes, stats
+}
+
+// Run the anytime search until it completes, the incumbent meets
+// root_bound, or the time budget, measured with the now clock, runs
+// out. Also return whether the search completed, which proves the
+// result is optimal, an upper bound on the optimum, the incumbent
+// trajectory, and the number of items fixed by reduced cost.
+func do_auto_exact(items []Item, allowed_weight, root_bound int, budget time.Duration, now func() time.Time) ([]Item, int, int, bool, int, []trajectory_point, int) {
+	order := density_order(items)
+	start := now()
+	best := incumbent{make([]bool, len(items)), 0, nil, 0, now, start, start.Add(budget), false, root_bound}
+
+	// Get a starting incumbent.
+	greedy_selection(items, allowed_weight)
+	exchange_local_search(items, allowed_weight)
+	selected := make([]bool, len(items))
+	for i := range items {
+		selected[i] = items[i].is_selected
+	}
+	best.improve(sum_values(items, false), selected)
+
+	// Only a better solution can replace the incumbent, so start the
+	// search with the fixed items decided and branch on the rest.
+	forced_in, forced_out := fix_by_reduced_cost(items, allowed_weight, best.value)
+	selected = make([]bool, len(items))
+	fixed := make([]bool, len(items))
+	current_value, current_weight := 0, 0
+	for _, i := range forced_in {
+		selected[i] = true
+		fixed[i] = true
+		current_value += items[i].value
+		current_weight += items[i].weight
+	}
+	for _, i := range forced_out {
+		fixed[i] = true
+	}
+	free_order := make([]int, 0, len(order))
+	for _, i := range order {
+		if !fixed[i] {
+			free_order = append(free_order, i)
+		}
+	}
+	do_anytime_branch_and_bound(items, free_order, allowed_weight, 0, current_value, current_weight, selected, &best)
+
+	// If the search finished, the incumbent is optimal.
+	// Otherwise the root bound still limits the optimum.
+	upper_bound := best.value
+	if best.expired && root_bound > upper_bound {
+		upper_bound = root_bound
+	}
+
+	for i := range items {
+		items[i].is_selected = best.selected[i]
+	}
+	return copy_items(items), best.value, best.nodes, !best.expired, upper_bound, best.trajectory, len(forced_in) + len(forced_out)
+}
+
+// Return the positions of the items that must be in, and those that
+// must be out, of every solution worth more than incumbent. Dantzig's
+// bound U packs the items by density until the critical item s doesn't
+// fit, so each unit of capacity is worth v_s/w_s at the margin. Item j's
+// reduced cost d_j = v_j - w_j*v_s/w_s is at least how much the bound
+// drops if j goes against the bound's choice, so if U - |d_j| is below
+// incumbent + 1, j must stay as the bound has it. We multiply through
+// by w_s to stay in integers. If every item fits, or the capacity is
+// negative, there is no critical item and we fix nothing.
+func fix_by_reduced_cost(items []Item, allowed_weight, incumbent int) ([]int, []int) {
+	if allowed_weight < 0 {
+		return nil, nil
+	}
+	in_bound := make([]bool, len(items))
+	bound_value, remaining_weight, critical := 0, allowed_weight, -1
+	for _, i := range density_order(items) {
+		if items[i].weight > remaining_weight {
+			critical = i
+			break
+		}
+		in_bound[i] = true
+		bound_value += items[i].value
+		remaining_weight -= items[i].weight
+	}
+	if critical < 0 {
+		return nil, nil
+	}
+
+	critical_value, critical_weight := items[critical].value, items[critical].weight
+	scaled_bound := bound_value*critical_weight + critical_value*remaining_weight
+	scaled_target := (incumbent + 1) * critical_weight
+	var forced_in, forced_out []int
+	for i, item := range items {
+		if i == critical {
+			continue
+		}
+		reduced_cost := item.value*critical_weight - critical_value*item.weight
+		if scaled_bound-max(reduced_cost, -reduced_cost) >= scaled_target {
+			continue
+		}
+		if in_bound[i] {
+			forced_in = append(forced_in, i)
+		} else {
+			forced_out = append(forced_out, i)
+		}
+	}
+	return forced_in, forced_out
+}
+
+// Return Dantzig's bound for the items order[depth:] with the remaining capacity.
+func sorted_bound(items []Item, order []int, depth, remaining_weight int) int {
+	bound := 0
+	for _, i := range order[depth:] {
+		if items[i].weight <= remaining_weight {
+			bound += items[i].value
+			remaining_weight -= items[i].weight
+		} else {
+			// A free item only fails to fit when the capacity is already negative.
+			if items[i].weight > 0 {
+				bound += items[i].value * remaining_weight / items[i].weight
+			}
+			break
+		}
+	}
+	return bound
+}
+
+// Decide the items in density order, pruning nodes whose Dantzig bound
+// can't beat the incumbent. Stop when the deadline passes or the
+// incumbent meets the root bound.
+func do_anytime_branch_and_bound(items []Item, order []int, allowed_weight, depth, current_value, current_weight int, selected []bool, best *incumbent) {
+	best.nodes++
+	if best.value >= best.root_bound {
+		return
+	}
+	if best.expired || (best.nodes%1024 == 0 && best.now().After(best.deadline)) {
+		best.expired = true
+		return
+	}
+
+	if depth >= len(order) {
+		if current_value > best.value {
+			best.improve(current_value, selected)
+		}
+		return
+	}
+
+	if current_value+sorted_bound(items, order, depth, allowed_weight-current_weight) <= best.value {
+		return
+	}
+
+	i := order[depth]
+	if current_weight+items[i].weight <= allowed_weight {
+		selected[i] = true
+		do_anytime_branch_and_bound(items, order, allowed_weight, depth+1, current_value+items[i].value, current_weight+items[i].weight, selected, best)
+		selected[i] = false
+	}
+	do_anytime_branch_and_bound(items, order, allowed_weight, depth+1, current_value, current_weight, selected, best)
+}
+
+// Use large neighborhood search to find a solution.
+// Return the best assignment, value of that assignment,
+// and the number of iterations we made.
+func large_neighborhood_search(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, solver_stats{}
+	}
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	best_items, best_value, improvements, trajectory :=
+		do_large_neighborhood_search(items, allowed_weight, lns_iterations, lns_destroy_fraction, random)
+	details := []string{fmt.Sprintf("Improvements: %d, Trajectory: %v", improvements, trajectory)}
+	return best_items, best_value, lns_iterations, solver_stats{unit: "Iterations", details: details}
+}
+
+// Start from the greedy solution. In each iteration remove a random
+// destroy_fraction of the selected items and refill the freed capacity
+// optimally from the unselected items with dynamic programming.
+// The repair can always put the removed items back, so the value never
+// gets worse. Also return the number of improvements and the value
+// after each one.
+func do_large_neighborhood_search(items []Item, allowed_weight, iterations int, destroy_fraction float64, random *rand.Rand) ([]Item, int, int, []int) {
+	greedy_selection(items, allowed_weight)
+	best_value := sum_values(items, false)
+	trajectory := []int{best_value}
+	improvements := 0
+	for iteration := 0; iteration < iterations; iteration++ {
+		// Destroy: deselect a random part of the solution.
+		for i := range items {
+			if items[i].is_selected && random.Float64() < destroy_fraction {
+				items[i].is_selected = false
+			}
+		}
+
+		// Repair: solve the subproblem of the unselected items exactly.
+		free_weight := allowed_weight - sum_weights(items, false)
+		var free_indices []int
+		var free_items []Item
+		for i := range items {
+			if !items[i].is_selected {
+				free_indices = append(free_indices, i)
+				free_items = append(free_items, items[i])
+			}
+		}
+		if len(free_items) > 0 {
+			repaired, _, _ := dynamic_programming(free_items, free_weight)
+			for k, i := range free_indices {
+				items[i].is_selected = repaired[k].is_selected
+			}
+		}
+
+		value := sum_values(items, false)
+		if value > best_value {
+			best_value = value
+			improvements++
+			trajectory = append(trajectory, value)
+		}
+	}
+	return copy_items(items), best_value, improvements, trajectory
+}
+
+// Use branch and bound over the number of copies of each item.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func bounded_branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	order := density_order(items)
+	for i := range items {
+		items[i].num_selected = 0
+		items[i].is_selected = false
+	}
+
+	// Nothing beats Dantzig's bound at the root, so the search can stop
+	// as soon as the incumbent reaches it.
+	root_bound := dantzig_bound(items, order, 0, allowed_weight)
+
+	// Remember only how many copies of each item the best selection
+	// has. The empty selection is the starting incumbent, so we always
+	// have a solution that matches the best value.
+	best_counts := make([]int, len(items))
+	best_value, function_calls := do_bounded_branch_and_bound(items, order, allowed_weight, 0, best_counts, 0, 0, 0, root_bound)
+	for i := range items {
+		items[i].num_selected = best_counts[i]
+		items[i].is_selected = best_counts[i] > 0
+	}
+	return copy_items(items), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its counts in best_counts.
+// Return the new best value and the number of function calls we made.
+func do_bounded_branch_and_bound(items []Item, order []int, allowed_weight, next_index int, best_counts []int, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_counts[i] = items[i].num_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	if best_value >= root_bound || current_value+dantzig_bound(items, order, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	// Try every count that fits, most copies first.
+	max_count := items[next_index].quantity
+	if items[next_index].weight > 0 && (allowed_weight-current_weight)/items[next_index].weight < max_count {
+		max_count = (allowed_weight - current_weight) / items[next_index].weight
+	}
+
+	function_calls := 1
+	var calls int
+	for count := max_count; count >= 0; count-- {
+		items[next_index].num_selected = count
+		items[next_index].is_selected = count > 0
+		best_value, calls = do_bounded_branch_and_bound(items, order, allowed_weight, next_index+1, best_counts, best_value,
+			current_value+count*items[next_index].value, current_weight+count*items[next_index].weight, root_bound)
+		function_calls += calls
+	}
+	items[next_index].num_selected = 0
+	items[next_index].is_selected = false
+
+	return best_value, function_calls
+}
+
+// Use dynamic programming on the bounded knapsack.
+// Split each item's copies into pieces of 1, 2, 4, ... copies plus the
+// rest, so every count from 0 to quantity is a sum of distinct pieces,
+// and solve the 0/1 problem on the pieces.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func bounded_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	var pieces []Item
+	var owners []int // The item each piece comes from.
+	var sizes []int  // The number of copies in each piece.
+	for i, item := range items {
+		left := item.quantity
+		for size := 1; left > 0; size *= 2 {
+			if size > left {
+				size = left
+			}
+			piece := item
+			piece.value *= size
+			piece.weight *= size
+			piece.quantity = 1
+			pieces = append(pieces, piece)
+			owners = append(owners, i)
+			sizes = append(sizes, size)
+			left -= size
+		}
+	}
+
+	for i := range items {
+		items[i].num_selected = 0
+		items[i].is_selected = false
+	}
+	if len(pieces) == 0 {
+		return copy_items(items), 0, 0
+	}
+
+	solution, total_value, function_calls := dynamic_programming(pieces, allowed_weight)
+	for k, piece := range solution {
+		if piece.is_selected {
+			items[owners[k]].num_selected += sizes[k]
+			items[owners[k]].is_selected = true
+		}
+	}
+	return copy_items(items), total_value, function_calls
+}
+
+// Return an error if some item has no weight but positive value,
+// which makes the unbounded knapsack's value infinite.
+func check_unbounded(items []Item) error {
+	for i, item := range items {
+		if item.weight == 0 && item.value > 0 {
+			return fmt.Errorf("item %d has weight 0 and value %d, so the value is unbounded", i, item.value)
+		}
+	}
+	return nil
+}
+
+// Use branch and bound on the unbounded knapsack, where every item
+// may be taken any number of times. Items are decided in density order,
+// so the best value we can still add is at most the current item's
+// density times the remaining capacity.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func unbounded_branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	// Skip items that can never help.
+	var order []int
+	for _, i := range density_order(items) {
+		if items[i].weight > 0 && items[i].value > 0 {
+			order = append(order, i)
+		}
+	}
+	for i := range items {
+		items[i].num_selected = 0
+		items[i].is_selected = false
+	}
+
+	// Nothing beats the densest item's bound at the root, so the search
+	// can stop as soon as the incumbent reaches it.
+	root_bound := 0
+	if len(order) > 0 {
+		root_bound = items[order[0]].value * allowed_weight / items[order[0]].weight
+	}
+
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_counts := make([]int, len(items))
+	best_value, function_calls := do_unbounded_branch_and_bound(items, order, allowed_weight, 0, best_counts, 0, 0, 0, root_bound)
+	for i := range items {
+		items[i].num_selected = best_counts[i]
+		items[i].is_selected = best_counts[i] > 0
+	}
+	return copy_items(items), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its counts in best_counts.
+// Return the new best value and the number of function calls we made.
+func do_unbounded_branch_and_bound(items []Item, order []int, allowed_weight, depth int, best_counts []int, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if depth >= len(order) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_counts[i] = items[i].num_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	i := order[depth]
+	remaining_weight := allowed_weight - current_weight
+	if best_value >= root_bound || current_value+items[i].value*remaining_weight/items[i].weight <= best_value {
+		return best_value, 1
+	}
+
+	// Try every count that fits, most copies first.
+	function_calls := 1
+	var calls int
+	for count := remaining_weight / items[i].weight; count >= 0; count-- {
+		items[i].num_selected = count
+		items[i].is_selected = count > 0
+		best_value, calls = do_unbounded_branch_and_bound(items, order, allowed_weight, depth+1, best_counts, best_value,
+			current_value+count*items[i].value, current_weight+count*items[i].weight, root_bound)
+		function_calls += calls
+	}
+	items[i].num_selected = 0
+	items[i].is_selected = false
+
+	return best_value, function_calls
+}
+
+// Use dynamic programming on the unbounded knapsack.
+// best_value_array[w] holds the best value with capacity w and
+// last_item_array[w] the item added last to reach it, or -1 if the
+// best value for w is the one for w - 1.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func unbounded_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	best_value_array := make([]int, allowed_weight+1)
+	last_item_array := make([]int, allowed_weight+1)
+	last_item_array[0] = -1
+	for w := 1; w <= allowed_weight; w++ {
+		best_value_array[w] = best_value_array[w-1]
+		last_item_array[w] = -1
+		for i, item := range items {
+			if item.weight > 0 && item.weight <= w && best_value_array[w-item.weight]+item.value > best_value_array[w] {
+				best_value_array[w] = best_value_array[w-item.weight] + item.value
+				last_item_array[w] = i
+			}
+		}
+	}
+
+	// Walk back through the items added last.
+	for i := range items {
+		items[i].num_selected = 0
+		items[i].is_selected = false
+	}
+	for w := allowed_weight; w > 0; {
+		i := last_item_array[w]
+		if i == -1 {
+			w--
+			continue
+		}
+		items[i].num_selected++
+		items[i].is_selected = true
+		w -= items[i].weight
+	}
+	return copy_items(items), best_value_array[allowed_weight], allowed_weight * len(items)
+}
+
+// Put the items into num_groups option groups, round robin.
+func make_groups(items []Item, num_groups int) {
+	for i := range items {
+		items[i].group = i % num_groups
+	}
+}
+
+// Return the items' indices for each group, in group order.
+func group_members(items []Item) [][]int {
+	num_groups := 0
+	for _, item := range items {
+		if item.group+1 > num_groups {
+			num_groups = item.group + 1
+		}
+	}
+	members := make([][]int, num_groups)
+	for i, item := range items {
+		members[item.group] = append(members[item.group], i)
+	}
+	return members
+}
+
+// Return an error if we can't pick one item from every group,
+// either because a group is empty or because even the lightest
+// item of every group together is too heavy.
+func check_multiple_choice(items []Item, allowed_weight int) error {
+	min_total := 0
+	for g, members := range group_members(items) {
+		if len(members) == 0 {
+			return fmt.Errorf("group %d has no items", g)
+		}
+		min_weight := items[members[0]].weight
+		for _, i := range members {
+			if items[i].weight < min_weight {
+				min_weight = items[i].weight
+			}
+		}
+		min_total += min_weight
+	}
+	if min_total > allowed_weight {
+		return fmt.Errorf("the lightest choice weighs %d, more than the allowed weight %d", min_total, allowed_weight)
+	}
+	return nil
+}
+
+// Use dynamic programming on the multiple-choice knapsack, where we
+// must pick exactly one item from each group. For the first g + 1
+// groups, solution_value_array[g][w] holds the best value within
+// weight w, or -1 if no choice fits, and choice_array[g][w] the item
+// picked from group g.
+// Without a feasible choice the empty selection comes back.
+// Return the best assignment, value of that assignment, the number of
+// table cells we computed, and whether any choice fits.
+func multiple_choice_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	members := group_members(items)
+	for i := range items {
+		items[i].is_selected = false
+	}
+	if len(members) == 0 {
+		return copy_items(items), 0, 0, true
+	}
+	// No group's choice fits in a negative capacity.
+	if allowed_weight < 0 {
+		return copy_items(items), 0, 0, false
+	}
+	cells := len(members) * (allowed_weight + 1)
+
+	solution_value_array := getSliceOfSlices(len(members), allowed_weight+1)
+	choice_array := getSliceOfSlices(len(members), allowed_weight+1)
+	for g := range members {
+		for w := 0; w <= allowed_weight; w++ {
+			solution_value_array[g][w] = -1
+			choice_array[g][w] = -1
+			for _, i := range members[g] {
+				if items[i].weight > w {
+					continue
+				}
+				// Value of the earlier groups with the rest of the capacity.
+				previous_value := 0
+				if g > 0 {
+					previous_value = solution_value_array[g-1][w-items[i].weight]
+				}
+				if previous_value >= 0 && previous_value+items[i].value > solution_value_array[g][w] {
+					solution_value_array[g][w] = previous_value + items[i].value
+					choice_array[g][w] = i
+				}
+			}
+		}
+	}
+
+	last := len(members) - 1
+	if solution_value_array[last][allowed_weight] < 0 {
+		return copy_items(items), 0, cells, false
+	}
+
+	// Walk back through the choices.
+	w := allowed_weight
+	for g := last; g >= 0; g-- {
+		i := choice_array[g][w]
+		items[i].is_selected = true
+		w -= items[i].weight
+	}
+	return copy_items(items), solution_value_array[last][allowed_weight], cells, true
+}
+
+// Give each item a random volume.
+func make_volumes(items []Item, min_volume, max_volume int) {
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	for i := range items {
+		items[i].volume = random.Intn(max_volume-min_volume+1) + min_volume
+	}
+}
+
+// Return the total volume of the items.
+// If add_all is false, only add up the selected items.
+func sum_volumes(items []Item, add_all bool) int {
+	total := 0
+	for i := 0; i < len(items); i++ {
+		if add_all || items[i].is_selected {
+			total += items[i].volume
+		}
+	}
+	return total
+}
+
+// Return an error if the two-dimensional table would have more than
+// max_dp_cells cells.
+func check_two_dimensional_size(items []Item, allowed_weight, allowed_volume int) error {
+	cells := float64(len(items)+1) * (float64(allowed_weight) + 1) * (float64(allowed_volume) + 1)
+	if cells > max_dp_cells {
+		return fmt.Errorf("the table would need %.0f cells, more than the limit of %d", cells, max_dp_cells)
+	}
+	return nil
+}
+
+// Use dynamic programming on the knapsack with both a weight and a
+// volume limit. solution_value_array[i][w][v] holds the best value of
+// the first i items within weight w and volume v.
+// Call check_two_dimensional_size first to keep the table in memory.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func two_dimensional_dynamic_programming(items []Item, allowed_weight, allowed_volume int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 || allowed_volume < 0 {
+		return empty_solution(items), 0, 0
+	}
+	solution_value_array := make([][][]int, len(items)+1)
+	for i := range solution_value_array {
+		solution_value_array[i] = getSliceOfSlices(allowed_weight+1, allowed_volume+1)
+	}
+
+	for i := 1; i <= len(items); i++ {
+		item := items[i-1]
+		for w := 0; w <= allowed_weight; w++ {
+			for v := 0; v <= allowed_volume; v++ {
+				best := solution_value_array[i-1][w][v]
+				if item.weight <= w && item.volume <= v {
+					value_with_item := solution_value_array[i-1][w-item.weight][v-item.volume] + item.value
+					if value_with_item > best {
+						best = value_with_item
+					}
+				}
+				solution_value_array[i][w][v] = best
+			}
+		}
+	}
+
+	// An item is selected if it changed the best value.
+	w := allowed_weight
+	v := allowed_volume
+	for i := len(items); i >= 1; i-- {
+		items[i-1].is_selected = solution_value_array[i][w][v] != solution_value_array[i-1][w][v]
+		if items[i-1].is_selected {
+			w -= items[i-1].weight
+			v -= items[i-1].volume
+		}
+	}
+	cells := len(items) * (allowed_weight + 1) * (allowed_volume + 1)
+	return copy_items(items), solution_value_array[len(items)][allowed_weight][allowed_volume], cells
+}
+
+// Use branch and bound on the knapsack with both a weight and a volume
+// limit. Each limit alone gives a Dantzig bound, and we use the tighter.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func two_dimensional_branch_and_bound(items []Item, allowed_weight, allowed_volume int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	// Bound the volume with items whose weight is their volume.
+	volume_items := copy_items(items)
+	for i := range volume_items {
+		volume_items[i].weight = volume_items[i].volume
+	}
+
+	// Nothing beats the tighter bound at the root, so the search can
+	// stop as soon as the incumbent reaches it.
+	root_bound := min(dantzig_bound(items, density_order(items), 0, allowed_weight),
+		dantzig_bound(volume_items, density_order(volume_items), 0, allowed_volume))
+
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_two_dimensional_branch_and_bound(items, density_order(items), volume_items, density_order(volume_items),
+		allowed_weight, allowed_volume, 0, best_selection, 0, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_two_dimensional_branch_and_bound(items []Item, order []int, volume_items []Item, volume_order []int,
+	allowed_weight, allowed_volume, next_index int, best_selection []bool, best_value, current_value, current_weight, current_volume, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	bound := dantzig_bound(items, order, next_index, allowed_weight-current_weight)
+	volume_bound := dantzig_bound(volume_items, volume_order, next_index, allowed_volume-current_volume)
+	if volume_bound < bound {
+		bound = volume_bound
+	}
+	if best_value >= root_bound || current_value+bound <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	if current_weight+items[next_index].weight <= allowed_weight && current_volume+items[next_index].volume <= allowed_volume {
+		items[next_index].is_selected = true
+		best_value, calls = do_two_dimensional_branch_and_bound(items, order, volume_items, volume_order,
+			allowed_weight, allowed_volume, next_index+1, best_selection, best_value,
+			current_value+items[next_index].value, current_weight+items[next_index].weight, current_volume+items[next_index].volume, root_bound)
+		function_calls += calls
+	}
+
+	items[next_index].is_selected = false
+	best_value, calls = do_two_dimensional_branch_and_bound(items, order, volume_items, volume_order,
+		allowed_weight, allowed_volume, next_index+1, best_selection, best_value, current_value, current_weight, current_volume, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Print each knapsack's items, weight and slack.
+func print_knapsacks(items []Item, capacities []int) {
+	for k, capacity := range capacities {
+		weight := 0
+		fmt.Printf("Knapsack %d: ", k)
+		for i, item := range items {
+			if item.is_selected && item.knapsack == k {
+				fmt.Printf("%d(%d, %d) ", i, item.value, item.weight)
+				weight += item.weight
+			}
+		}
+		fmt.Printf("Weight: %d/%d, Slack: %d\n", weight, capacity, capacity-weight)
+	}
+}
+
+func run_multiple_knapsack(alg func([]Item, []int) ([]Item, int, int), items []Item, capacities []int) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls := alg(test_items, capacities)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_knapsacks(solution, capacities)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), function_calls)
+	// A knapsack with a negative capacity holds nothing, so it adds
+	// nothing to the total.
+	total_capacity := 0
+	for _, capacity := range capacities {
+		total_capacity += max(capacity, 0)
+	}
+	report_mismatch(verify_solution(items, solution, total_value, total_capacity, within_capacities(capacities)))
+	fmt.Println()
+}
+
+// Check that every selected item is in one of the knapsacks and that
+// no knapsack holds more than its capacity.
+func within_capacities(capacities []int) constraint_check {
+	return func(solution []Item) error {
+		weights := make([]int, len(capacities))
+		for i, item := range solution {
+			if !item.is_selected {
+				continue
+			}
+			if item.knapsack < 0 || item.knapsack >= len(capacities) {
+				return fmt.Errorf("the solution selects item %d without putting it in a knapsack", i)
+			}
+			weights[item.knapsack] += item.weight
+		}
+		for k, weight := range weights {
+			if weight > capacities[k] {
+				return fmt.Errorf("knapsack %d holds weight %d, more than its capacity %d", k, weight, capacities[k])
+			}
+		}
+		return nil
+	}
+}
+
+// Put each item, densest first, in the first knapsack it fits in.
+// Return the assignment, value of that assignment,
+// and the number of items we placed.
+func first_fit(items []Item, capacities []int) ([]Item, int, int) {
+	items = copy_items(items)
+	remaining := make([]int, len(capacities))
+	copy(remaining, capacities)
+	placed := 0
+	for _, i := range density_order(items) {
+		items[i].is_selected = false
+		items[i].knapsack = -1
+		for k := range remaining {
+			if items[i].weight <= remaining[k] {
+				items[i].is_selected = true
+				items[i].knapsack = k
+				remaining[k] -= items[i].weight
+				placed++
+				break
+			}
+		}
+	}
+	return copy_items(items), sum_values(items, false), placed
+}
+
+// Use branch and bound to assign items to the knapsacks.
+// Items are decided in density order, and each one goes in one of the
+// knapsacks or in none. Treating all knapsacks as one with the total
+// capacity gives Dantzig's bound.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func multiple_knapsack_branch_and_bound(items []Item, capacities []int) ([]Item, int, int) {
+	items = copy_items(items)
+	remaining := make([]int, len(capacities))
+	copy(remaining, capacities)
+	for i := range items {
+		items[i].is_selected = false
+		items[i].knapsack = -1
+	}
+
+	// Remember only which knapsack each item of the best assignment goes
+	// in, or -1. Leaving every item out is the starting incumbent, so we
+	// always have a solution that matches the best value.
+	best_knapsacks := make([]int, len(items))
+	for i := range best_knapsacks {
+		best_knapsacks[i] = -1
+	}
+
+	// Nothing beats Dantzig's bound for the total capacity at the root,
+	// so the search can stop as soon as the incumbent reaches it.
+	total_capacity := 0
+	for _, capacity := range capacities {
+		total_capacity += max(capacity, 0)
+	}
+	order := density_order(items)
+	root_bound := sorted_bound(items, order, 0, total_capacity)
+	best_value, function_calls := do_multiple_knapsack_branch_and_bound(items, order, remaining, 0, best_knapsacks, 0, 0, root_bound)
+	for i := range items {
+		items[i].knapsack = best_knapsacks[i]
+		items[i].is_selected = best_knapsacks[i] >= 0
+	}
+	return copy_items(items), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its knapsacks in best_knapsacks.
+// Return the new best value and the number of function calls we made.
+func do_multiple_knapsack_branch_and_bound(items []Item, order []int, remaining []int, depth int, best_knapsacks []int, best_value, current_value, root_bound int) (int, int) {
+	if depth >= len(order) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_knapsacks[i] = items[i].knapsack
+			}
+		}
+		return best_value, 1
+	}
+
+	// A knapsack with a negative capacity holds nothing, but it doesn't
+	// take room from the others either.
+	total_remaining := 0
+	for _, weight := range remaining {
+		total_remaining += max(weight, 0)
+	}
+	if best_value >= root_bound || current_value+sorted_bound(items, order, depth, total_remaining) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+	i := order[depth]
+
+	// Try each knapsack, then leaving the item out (k = -1).
+	for k := len(remaining) - 1; k >= -1; k-- {
+		if k >= 0 {
+			if items[i].weight > remaining[k] {
+				continue
+			}
+			// Knapsacks with the same room left give the same subtrees.
+			is_repeat := false
+			for other := k + 1; other < len(remaining); other++ {
+				if remaining[other] == remaining[k] {
+					is_repeat = true
+				}
+			}
+			if is_repeat {
+				continue
+			}
+			remaining[k] -= items[i].weight
+		}
+		items[i].is_selected = k >= 0
+		items[i].knapsack = k
+
+		value_added := 0
+		if k >= 0 {
+			value_added = items[i].value
+		}
+		best_value, calls = do_multiple_knapsack_branch_and_bound(items, order, remaining, depth+1, best_knapsacks, best_value, current_value+value_added, root_bound)
+		function_calls += calls
+
+		if k >= 0 {
+			remaining[k] += items[i].weight
+		}
+	}
+	items[i].is_selected = false
+	items[i].knapsack = -1
+
+	return best_value, function_calls
+}
+
+// Run an algorithm for a constrained variant that may have no solution.
+// constraint describes what no selection managed, for the report.
+// check verifies the constraint for the solutions that meet it.
+func run_constrained(alg func([]Item, int) ([]Item, int, int, bool), items []Item, allowed_weight int, constraint string, check constraint_check) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls, feasible := alg(test_items, allowed_weight)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	if !feasible {
+		fmt.Printf("Infeasible: no selection %s, Calls: %d\n", constraint, function_calls)
+		fmt.Println()
+		return
+	}
+	print_selected(solution)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), function_calls)
+	report_mismatch(verify_solution(items, solution, total_value, allowed_weight, check))
+	fmt.Println()
+}
+
+// Check that a solution weighs exactly weight.
+func weighs_exactly(weight int) constraint_check {
+	return func(solution []Item) error {
+		if w := sum_weights(solution, false); w != weight {
+			return fmt.Errorf("the solution weighs %d, not %d", w, weight)
+		}
+		return nil
+	}
+}
+
+// Check that a solution is worth at least value.
+func worth_at_least(value int) constraint_check {
+	return func(solution []Item) error {
+		if v := sum_values(solution, false); v < value {
+			return fmt.Errorf("the solution is worth %d, less than %d", v, value)
+		}
+		return nil
+	}
+}
+
+// Check that a solution selects exactly one item from each group.
+func one_per_group(solution []Item) error {
+	for g, members := range group_members(solution) {
+		selected := 0
+		for _, i := range members {
+			if solution[i].is_selected {
+				selected++
+			}
+		}
+		if selected != 1 {
+			return fmt.Errorf("the solution selects %d items from group %d", selected, g)
+		}
+	}
+	return nil
+}
+
+// Use dynamic programming to find the best selection that weighs
+// exactly allowed_weight.
+// Return the best assignment, value of that assignment, the number of
+// table cells we computed, and whether any selection has that weight.
+func exact_weight_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, false
+	}
+	items = copy_items(items)
+	cells := len(items) * (allowed_weight + 1)
+	// The bitset tells us cheaply whether any selection has the weight,
+	// so we only build the value table if one does.
+	if !is_reachable(reachable_weights(items, allowed_weight), allowed_weight) {
+		for i := range items {
+			items[i].is_selected = false
+		}
+		return copy_items(items), 0, cells, false
+	}
+	solution_value_array := exact_weight_table(items, allowed_weight)
+	total_value := solution_value_array[len(items)][allowed_weight]
+	select_exact_weight(items, solution_value_array, allowed_weight)
+	return copy_items(items), total_value, cells, true
+}
+
+// Marks a weight no selection of the items adds up to.
+const unreachable = math.MinInt
+
+// Build the table where entry [i][w] is the best value of a selection
+// from the first i items that weighs exactly w, or unreachable.
+func exact_weight_table(items []Item, max_weight int) [][]int {
+	solution_value_array := getSliceOfSlices(len(items)+1, max_weight+1)
+	for w := 1; w <= max_weight; w++ {
+		solution_value_array[0][w] = unreachable
+	}
+	for i := 1; i <= len(items); i++ {
+		item := items[i-1]
+		for w := 0; w <= max_weight; w++ {
+			best := solution_value_array[i-1][w]
+			if item.weight <= w && solution_value_array[i-1][w-item.weight] != unreachable {
+				value_with_item := solution_value_array[i-1][w-item.weight] + item.value
+				if value_with_item > best {
+					best = value_with_item
+				}
+			}
+			solution_value_array[i][w] = best
+		}
+	}
+	return solution_value_array
+}
+
+// Select the items of a best selection that weighs exactly weight,
+// which the table must show is reachable.
+func select_exact_weight(items []Item, solution_value_array [][]int, weight int) {
+	for i := range items {
+		items[i].is_selected = false
+	}
+	// An item is selected if skipping it can't give the same value.
+	for i := len(items); i >= 1; i-- {
+		if solution_value_array[i][weight] != solution_value_array[i-1][weight] {
+			items[i-1].is_selected = true
+			weight -= items[i-1].weight
+		}
+	}
+}
+
+// Return a bitset of the weights up to max_weight that some selection
+// of the items weighs exactly. Bit w of word w/64 is set if weight w
+// is reachable.
+func reachable_weights(items []Item, max_weight int) []uint64 {
+	reachable := make([]uint64, max_weight/64+1)
+	reachable[0] = 1
+	for _, item := range items {
+		shift_or(reachable, reachable, item.weight)
+	}
+	// Clear the bits past max_weight in the last word.
+	reachable[len(reachable)-1] &= 1<<uint(max_weight%64+1) - 1
+	return reachable
+}
+
+// Set row to previous OR previous shifted left by shift bits, carrying
+// bits across words and dropping the ones shifted past the end.
+// row and previous may be the same slice, since each word only reads
+// the words at or below it and we go from the top down.
+func shift_or(row, previous []uint64, shift int) {
+	word_shift := shift / 64
+	bit_shift := uint(shift % 64)
+	for w := len(row) - 1; w >= 0; w-- {
+		shifted := uint64(0)
+		if w-word_shift >= 0 {
+			shifted = previous[w-word_shift] << bit_shift
+			if bit_shift > 0 && w-word_shift-1 >= 0 {
+				shifted |= previous[w-word_shift-1] >> (64 - bit_shift)
+			}
+		}
+		row[w] = previous[w] | shifted
+	}
+}
+
+// Return true if bit v of the bitset is set.
+func is_reachable(row []uint64, v int) bool {
+	return row[v/64]&(1<<uint(v%64)) != 0
+}
+
+// A point on the Pareto front of weight versus value.
+type front_point struct {
+	weight, value int
+	items         []Item // A selection with this weight and value, if we rebuilt one.
+}
+
+// Find the Pareto front of selections that weigh at most max_weight:
+// every (weight, value) pair that no lighter selection matches in value.
+// Keep at most max_points evenly spaced points (0 keeps them all) and,
+// if reconstruct is set, rebuild one selection for each point kept.
+func pareto_front(items []Item, max_weight, max_points int, reconstruct bool) []front_point {
+	// No selection weighs less than nothing.
+	if max_weight < 0 {
+		return nil
+	}
+	solution_value_array := exact_weight_table(items, max_weight)
+	last := solution_value_array[len(items)]
+
+	// Walk up the weights keeping each strict improvement in value.
+	var front []front_point
+	for w := 0; w <= max_weight; w++ {
+		if last[w] == unreachable {
+			continue
+		}
+		if len(front) == 0 || last[w] > front[len(front)-1].value {
+			front = append(front, front_point{w, last[w], nil})
+		}
+	}
+
+	front = thin_front(front, max_points)
+	if reconstruct {
+		for i := range front {
+			select_exact_weight(items, solution_value_array, front[i].weight)
+			front[i].items = copy_items(items)
+		}
+	}
+	return front
+}
+
+// Keep at most max_points evenly spaced points including both ends.
+// 0 keeps them all.
+func thin_front(front []front_point, max_points int) []front_point {
+	if max_points <= 0 || len(front) <= max_points {
+		return front
+	}
+	if max_points == 1 {
+		return front[len(front)-1:]
+	}
+	thinned := make([]front_point, max_points)
+	for i := range thinned {
+		thinned[i] = front[i*(len(front)-1)/(max_points-1)]
+	}
+	return thinned
+}
+
+// Print the front as CSV for plotting.
+// Rebuilt selections are listed as space-separated item ids.
+func print_front_csv(front []front_point) {
+	fmt.Println("weight,value,items")
+	for _, point := range front {
+		fmt.Printf("%d,%d,", point.weight, point.value)
+		separator := ""
+		for _, item := range point.items {
+			if item.is_selected {
+				fmt.Printf("%s%d", separator, item.id)
+				separator = " "
+			}
+		}
+		fmt.Println()
+	}
+}
+
+// Use branch and bound to find the best selection that weighs exactly
+// allowed_weight. Prune with Dantzig's bound, since a selection of that
+// weight fits in allowed_weight, and when even taking all remaining
+// items can't reach the weight.
+// Return the best assignment, value of that assignment, the number of
+// function calls we made, and whether any selection has that weight.
+func exact_weight_branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, false
+	}
+	remaining_weight := sum_weights(items, true)
+
+	order := density_order(items)
+	// Nothing beats Dantzig's bound at the root, so the search can stop
+	// as soon as the incumbent reaches it.
+	root_bound := dantzig_bound(items, order, 0, allowed_weight)
+
+	// Only selections of exactly allowed_weight count, so there is no
+	// starting incumbent. best_value = -1 until we find one.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_exact_weight_branch_and_bound(items, order, allowed_weight,
+		0, best_selection, -1, 0, 0, remaining_weight, root_bound)
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls, false
+	}
+	return apply_selection(items, best_selection), best_value, function_calls, true
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_exact_weight_branch_and_bound(items []Item, order []int, allowed_weight, next_index int, best_selection []bool, best_value, current_value, current_weight, remaining_weight, root_bound int) (int, int) {
+	// The two weight tests leave only leaves of exactly allowed_weight,
+	// except that a negative allowed_weight is too small even for the root.
+	if current_weight+remaining_weight < allowed_weight || current_weight > allowed_weight {
+		return best_value, 1
+	}
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+	if best_value >= root_bound || current_value+dantzig_bound(items, order, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	if current_weight+items[next_index].weight <= allowed_weight {
+		items[next_index].is_selected = true
+		best_value, calls = do_exact_weight_branch_and_bound(items, order, allowed_weight, next_index+1, best_selection, best_value,
+			current_value+items[next_index].value, current_weight+items[next_index].weight,
+			remaining_weight-items[next_index].weight, root_bound)
+		function_calls += calls
+	}
+
+	items[next_index].is_selected = false
+	best_value, calls = do_exact_weight_branch_and_bound(items, order, allowed_weight, next_index+1, best_selection, best_value,
+		current_value, current_weight,
+		remaining_weight-items[next_index].weight, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Return the number of selected items.
+func count_selected(items []Item) int {
+	count := 0
+	for _, item := range items {
+		if item.is_selected {
+			count++
+		}
+	}
+	return count
+}
+
+// Use dynamic programming to find the best selection of at most
+// max_items items. solution_value_array[i][c][w] holds the best value of
+// at most c of the first i items within weight w. With max_items >= n
+// the limit can't bind, so we use the plain dynamic programming.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func cardinality_dynamic_programming(items []Item, allowed_weight, max_items int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	if max_items >= len(items) && len(items) > 0 {
+		return dynamic_programming(items, allowed_weight)
+	}
+	if max_items < 0 {
+		max_items = 0
+	}
+
+	solution_value_array := make([][][]int, len(items)+1)
+	for i := range solution_value_array {
+		solution_value_array[i] = getSliceOfSlices(max_items+1, allowed_weight+1)
+	}
+	for i := 1; i <= len(items); i++ {
+		item := items[i-1]
+		for c := 0; c <= max_items; c++ {
+			for w := 0; w <= allowed_weight; w++ {
+				best := solution_value_array[i-1][c][w]
+				if c > 0 && item.weight <= w {
+					value_with_item := solution_value_array[i-1][c-1][w-item.weight] + item.value
+					if value_with_item > best {
+						best = value_with_item
+					}
+				}
+				solution_value_array[i][c][w] = best
+			}
+		}
+	}
+
+	// An item is selected if it changed the best value.
+	c := max_items
+	w := allowed_weight
+	for i := len(items); i >= 1; i-- {
+		items[i-1].is_selected = solution_value_array[i][c][w] != solution_value_array[i-1][c][w]
+		if items[i-1].is_selected {
+			c--
+			w -= items[i-1].weight
+		}
+	}
+	cells := len(items) * (max_items + 1) * (allowed_weight + 1)
+	return copy_items(items), solution_value_array[len(items)][max_items][allowed_weight], cells
+}
+
+// Use branch and bound to find the best selection of at most max_items
+// items. Once max_items items are selected, the rest are left out.
+// With max_items >= n the limit can't bind, so we use the plain branch
+// and bound.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func cardinality_branch_and_bound(items []Item, allowed_weight, max_items int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	if max_items >= len(items) {
+		solution, total_value, function_calls, _ := branch_and_bound(items, allowed_weight)
+		return solution, total_value, function_calls
+	}
+	for i := range items {
+		items[i].is_selected = false
+	}
+
+	// Order the items by value, too, for the count bound.
+	value_order := make([]int, len(items))
+	for i := range value_order {
+		value_order[i] = i
+	}
+	sort.SliceStable(value_order, func(i, j int) bool {
+		return items[value_order[i]].value > items[value_order[j]].value
+	})
+
+	// Nothing beats the tighter bound at the root, so the search can
+	// stop as soon as the incumbent reaches it.
+	order := density_order(items)
+	root_bound := min(dantzig_bound(items, order, 0, allowed_weight), top_values(items, value_order, 0, max_items))
+
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_cardinality_branch_and_bound(items, order, value_order, allowed_weight, max_items, 0, best_selection, 0, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// Return the total value of the most valuable count items in items[next_index:].
+func top_values(items []Item, value_order []int, next_index, count int) int {
+	total := 0
+	for _, i := range value_order {
+		if count <= 0 {
+			break
+		}
+		if i >= next_index {
+			total += items[i].value
+			count--
+		}
+	}
+	return total
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_cardinality_branch_and_bound(items []Item, order, value_order []int, allowed_weight, max_items, next_index int, best_selection []bool, best_value, current_value, current_weight, current_count, root_bound int) (int, int) {
+	// With no items left to decide, or no room for more items, this is a leaf.
+	if next_index >= len(items) || current_count >= max_items {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	// The weight and the count each limit what we can still add.
+	bound := dantzig_bound(items, order, next_index, allowed_weight-current_weight)
+	count_bound := top_values(items, value_order, next_index, max_items-current_count)
+	if count_bound < bound {
+		bound = count_bound
+	}
+	if best_value >= root_bound || current_value+bound <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	if current_weight+items[next_index].weight <= allowed_weight {
+		items[next_index].is_selected = true
+		best_value, calls = do_cardinality_branch_and_bound(items, order, value_order, allowed_weight, max_items, next_index+1, best_selection, best_value,
+			current_value+items[next_index].value, current_weight+items[next_index].weight, current_count+1, root_bound)
+		function_calls += calls
+	}
+
+	items[next_index].is_selected = false
+	best_value, calls = do_cardinality_branch_and_bound(items, order, value_order, allowed_weight, max_items, next_index+1, best_selection, best_value,
+		current_value, current_weight, current_count, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Return an error if even selecting every item doesn't reach the target value.
+func check_cover(items []Item, target_value int) error {
+	if total := sum_values(items, true); total < target_value {
+		return fmt.Errorf("the items are only worth %d in total, less than the target value %d", total, target_value)
+	}
+	return nil
+}
+
+// Marks a value no selection of the items adds up to.
+const unreachable_weight = math.MaxInt
+
+// Build the table where entry [i][v] is the least weight of a selection
+// from the first i items worth exactly v, or unreachable_weight.
+func min_weight_table(items []Item) [][]int {
+	total_value := sum_values(items, true)
+	min_weight_array := getSliceOfSlices(len(items)+1, total_value+1)
+	for v := 1; v <= total_value; v++ {
+		min_weight_array[0][v] = unreachable_weight
+	}
+	for i := 1; i <= len(items); i++ {
+		item := items[i-1]
+		for v := 0; v <= total_value; v++ {
+			best := min_weight_array[i-1][v]
+			if item.value <= v && min_weight_array[i-1][v-item.value] != unreachable_weight {
+				weight_with_item := min_weight_array[i-1][v-item.value] + item.weight
+				if weight_with_item < best {
+					best = weight_with_item
+				}
+			}
+			min_weight_array[i][v] = best
+		}
+	}
+	return min_weight_array
+}
+
+// Select the items of a lightest selection worth exactly value,
+// which the table must show is reachable.
+func select_min_weight(items []Item, min_weight_array [][]int, value int) {
+	for i := range items {
+		items[i].is_selected = false
+	}
+	// An item is selected if skipping it can't give the same weight.
+	for i := len(items); i >= 1; i-- {
+		if min_weight_array[i][value] != min_weight_array[i-1][value] {
+			items[i-1].is_selected = true
+			value -= items[i-1].value
+		}
+	}
+}
+
+// Use dynamic programming to find the lightest selection worth at least
+// target_value.
+// If the target can't be reached, the empty selection comes back.
+// Return the lightest assignment, value of that assignment, the number
+// of table cells we computed, and whether any selection reaches the target.
+func cover_dynamic_programming(items []Item, target_value int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	min_weight_array := min_weight_table(items)
+	last := min_weight_array[len(items)]
+	cells := len(items) * len(last)
+
+	// Find the lightest value that reaches the target.
+	best_value := -1
+	if target_value < 0 {
+		target_value = 0
+	}
+	for v := target_value; v < len(last); v++ {
+		if last[v] != unreachable_weight && (best_value < 0 || last[v] < last[best_value]) {
+			best_value = v
+		}
+	}
+	if best_value < 0 {
+		return empty_solution(items), 0, cells, false
+	}
+
+	select_min_weight(items, min_weight_array, best_value)
+	return copy_items(items), best_value, cells, true
+}
+
+// Use dynamic programming to find the selection within allowed_weight
+// whose value is closest to target_value, above or below. Ties go to
+// the lighter selection. If target_value is more than any selection
+// that fits is worth, we get the most valuable one.
+// Return the closest assignment, value of that assignment,
+// and the number of table cells we computed.
+func closest_dynamic_programming(items []Item, allowed_weight, target_value int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	min_weight_array := min_weight_table(items)
+	last := min_weight_array[len(items)]
+
+	// The empty selection always fits, so there is always an answer.
+	best_value := 0
+	distance := func(v int) int {
+		if v > target_value {
+			return v - target_value
+		}
+		return target_value - v
+	}
+	for v := 1; v < len(last); v++ {
+		if last[v] > allowed_weight {
+			continue
+		}
+		if distance(v) < distance(best_value) ||
+			(distance(v) == distance(best_value) && last[v] < last[best_value]) {
+			best_value = v
+		}
+	}
+
+	select_min_weight(items, min_weight_array, best_value)
+	return copy_items(items), best_value, len(items) * len(last)
+}
+
+// Make a few chains of items where each one requires the next.
+func make_requirements(items []Item) {
+	for i := 0; i+2 < len(items); i += 7 {
+		items[i].requires = []int{i + 1}
+		items[i+1].requires = []int{i + 2}
+	}
+}
+
+// Return an error if a requirement names a missing item
+// or if the requirements form a cycle.
+func check_requirements(items []Item) error {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(items))
+	var visit func(i int) error
+	visit = func(i int) error {
+		state[i] = visiting
+		for _, r := range items[i].requires {
+			if r < 0 || r >= len(items) {
+				return fmt.Errorf("item %d requires missing item %d", i, r)
+			}
+			if state[r] == visiting {
+				return fmt.Errorf("item %d is part of a requirement cycle", r)
+			}
+			if state[r] == unvisited {
+				if err := visit(r); err != nil {
+					return err
+				}
+			}
+		}
+		state[i] = done
+		return nil
+	}
+	for i := range items {
+		if state[i] == unvisited {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return the items that item i requires, directly or through other items.
+func required_items(items []Item, i int) []int {
+	var required []int
+	seen := make([]bool, len(items))
+	stack := append([]int{}, items[i].requires...)
+	for len(stack) > 0 {
+		r := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[r] {
+			continue
+		}
+		seen[r] = true
+		required = append(required, r)
+		stack = append(stack, items[r].requires...)
+	}
+	return required
+}
+
+// Set each item's block list to the items that require it, directly or
+// through other items, so rejecting it blocks them all.
+func make_requirement_block_lists(items []Item) {
+	for i := range items {
+		items[i].block_list = make([]int, 0)
+	}
+	for i := range items {
+		for _, r := range required_items(items, i) {
+			items[r].block_list = append(items[r].block_list, i)
+		}
+	}
+}
+
+// Use branch and bound where selecting an item also selects the items
+// it requires. Rejecting an item blocks every item that requires it,
+// the same way Rod's technique blocks dominated items.
+// Call check_requirements first; cycles would never resolve.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func requirements_branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	for i := range items {
+		items[i].is_selected = false
+		items[i].blocked_by = -1
+	}
+	make_requirement_block_lists(items)
+
+	// Nothing beats the bound at the root, where no item is blocked, so
+	// the search can stop as soon as the incumbent reaches it.
+	order := density_order(items)
+	root_bound := requirements_bound(items, order, 0, allowed_weight)
+
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_requirements_branch_and_bound(items, order, allowed_weight, 0, best_selection, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_requirements_branch_and_bound(items []Item, order []int, allowed_weight, next_index int, best_selection []bool, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	// Items selected because an earlier item required them are already decided.
+	if items[next_index].is_selected {
+		return do_requirements_branch_and_bound(items, order, allowed_weight, next_index+1, best_selection, best_value, current_value, current_weight, root_bound)
+	}
+
+	if best_value >= root_bound || current_value+requirements_bound(items, order, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	// Select the item and everything it requires, if none of that is blocked and it fits.
+	if items[next_index].blocked_by == -1 {
+		added := []int{next_index}
+		for _, r := range required_items(items, next_index) {
+			if !items[r].is_selected {
+				added = append(added, r)
+			}
+		}
+		added_value := 0
+		added_weight := 0
+		for _, i := range added {
+			added_value += items[i].value
+			added_weight += items[i].weight
+		}
+		if current_weight+added_weight <= allowed_weight {
+			for _, i := range added {
+				items[i].is_selected = true
+			}
+			best_value, calls = do_requirements_branch_and_bound(items, order, allowed_weight, next_index+1, best_selection, best_value,
+				current_value+added_value, current_weight+added_weight, root_bound)
+			function_calls += calls
+			for _, i := range added {
+				items[i].is_selected = false
+			}
+		}
+	}
+
+	// Reject the item, which blocks the items that require it.
+	block_items(next_index, items)
+	best_value, calls = do_requirements_branch_and_bound(items, order, allowed_weight, next_index+1, best_selection, best_value,
+		current_value, current_weight, root_bound)
+	unblock_items(next_index, items)
+
+	return best_value, function_calls + calls
+}
+
+// Return Dantzig's bound for the undecided items that aren't blocked.
+func requirements_bound(items []Item, order []int, next_index, remaining_weight int) int {
+	bound := 0
+	for _, i := range order {
+		if i < next_index || items[i].is_selected || items[i].blocked_by != -1 {
+			continue
+		}
+		if items[i].weight <= remaining_weight {
+			bound += items[i].value
+			remaining_weight -= items[i].weight
+		} else {
+			// A free item only fails to fit when the capacity is already negative.
+			if items[i].weight > 0 {
+				bound += items[i].value * remaining_weight / items[i].weight
+			}
+			break
+		}
+	}
+	return bound
+}
+
+// Arrange the items into a forest of small binary trees of eight items.
+func make_parents(items []Item) {
+	for i := range items {
+		if i%8 == 0 {
+			items[i].parent = -1
+		} else {
+			items[i].parent = i/8*8 + (i%8-1)/2
+		}
+	}
+}
+
+// Return an error if a parent is a missing item or the parents form a cycle.
+func check_parents(items []Item) error {
+	for i, item := range items {
+		if item.parent < -1 || item.parent >= len(items) {
+			return fmt.Errorf("item %d has missing parent %d", i, item.parent)
+		}
+	}
+	for i := range items {
+		// Any path of more than n parents must loop.
+		steps := 0
+		for j := items[i].parent; j != -1; j = items[j].parent {
+			steps++
+			if steps > len(items) {
+				return fmt.Errorf("item %d is part of a parent cycle", i)
+			}
+		}
+	}
+	return nil
+}
+
+// Make each item require its parent, so the tree-search solvers can
+// enforce the forest through the requirements.
+func parent_requirements(items []Item) {
+	for i := range items {
+		items[i].requires = nil
+		if items[i].parent != -1 {
+			items[i].requires = []int{items[i].parent}
+		}
+	}
+}
+
+// Use branch and bound on the forest: an item that requires its parent.
+// Call check_parents first.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func tree_branch_and_bound(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	parent_requirements(items)
+	return requirements_branch_and_bound(items, allowed_weight)
+}
+
+// Use dynamic programming on the forest. For each item we find the best
+// value of its subtree for every capacity when the item is selected, by
+// merging its children's value vectors one at a time. A virtual root
+// with index n, no weight and no value holds the forest's roots.
+// Call check_parents first.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func tree_dynamic_programming(items []Item, allowed_weight int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	root := len(items)
+	children := make([][]int, len(items)+1)
+	for i, item := range items {
+		if item.parent == -1 {
+			children[root] = append(children[root], i)
+		} else {
+			children[item.parent] = append(children[item.parent], i)
+		}
+	}
+
+	// splits[i][c] is the capacity given to i's subtree when i was merged
+	// into its parent at capacity c, or -1 if i isn't selected.
+	splits := make([][]int, len(items))
+	best := do_tree_dynamic_programming(items, children, root, allowed_weight, splits)
+
+	for i := range items {
+		items[i].is_selected = false
+	}
+	select_subtree(items, children, root, allowed_weight, splits)
+	// Every node fills one row, and merging each item into its
+	// parent fills another.
+	return copy_items(items), best[allowed_weight], (2*len(items) + 1) * (allowed_weight + 1)
+}
+
+// Return the best value of node's subtree for every capacity when node
+// is selected, or -1 where node doesn't fit.
+func do_tree_dynamic_programming(items []Item, children [][]int, node, allowed_weight int, splits [][]int) []int {
+	node_value, node_weight := 0, 0
+	if node < len(items) {
+		node_value, node_weight = items[node].value, items[node].weight
+	}
+
+	best := make([]int, allowed_weight+1)
+	for c := range best {
+		if c >= node_weight {
+			best[c] = node_value
+		} else {
+			best[c] = -1
+		}
+	}
+
+	for _, child := range children[node] {
+		child_best := do_tree_dynamic_programming(items, children, child, allowed_weight, splits)
+		splits[child] = make([]int, allowed_weight+1)
+		merged := make([]int, allowed_weight+1)
+		for c := range merged {
+			// Leave the child's subtree out.
+			merged[c] = best[c]
+			splits[child][c] = -1
+			if best[c] < 0 {
+				continue
 			}
-			//Choose the better of the two values.
-			if value_with_item > value_without_item {
-				solution_value_array[i][j] = value_with_item
-				prev_weight_array[i][j] = j - items[i].weight
-			} else {
-				solution_value_array[i][j] = value_without_item
-				prev_weight_array[i][j] = j
+			// Give the child's subtree k of the capacity.
+			for k := 0; k <= c; k++ {
+				if child_best[k] >= 0 && best[c-k] >= 0 && best[c-k]+child_best[k] > merged[c] {
+					merged[c] = best[c-k] + child_best[k]
+					splits[child][c] = k
+				}
+			}
+		}
+		best = merged
+	}
+	return best
+}
+
+// Mark node and the parts of its subtree in the best solution as selected.
+func select_subtree(items []Item, children [][]int, node, capacity int, splits [][]int) {
+	if node < len(items) {
+		items[node].is_selected = true
+	}
+	for k := len(children[node]) - 1; k >= 0; k-- {
+		child := children[node][k]
+		if splits[child][capacity] >= 0 {
+			select_subtree(items, children, child, splits[child][capacity], splits)
+			capacity -= splits[child][capacity]
+		}
+	}
+}
+
+// A bonus we get when both items i and j are selected.
+type synergy struct {
+	i, j, bonus int
+}
+
+// Add bonuses for some pairs of neighboring items.
+// The reversed and repeated pairs show off normalize_synergies.
+func make_synergies(num_items int) []synergy {
+	var synergies []synergy
+	for i := 0; i+1 < num_items; i += 5 {
+		synergies = append(synergies, synergy{i, i + 1, 4})
+		synergies = append(synergies, synergy{i + 1, i, 4})
+	}
+	return synergies
+}
+
+// Return the synergies with i < j and each pair listed once.
+// A pair listed more than once, in either order, keeps its largest bonus.
+// Pairs of an item with itself and pairs with missing items are errors.
+func normalize_synergies(synergies []synergy, num_items int) ([]synergy, error) {
+	index := make(map[[2]int]int)
+	var normalized []synergy
+	for _, s := range synergies {
+		if s.i < 0 || s.j < 0 || s.i >= num_items || s.j >= num_items {
+			return nil, fmt.Errorf("synergy (%d, %d) names a missing item", s.i, s.j)
+		}
+		if s.i == s.j {
+			return nil, fmt.Errorf("synergy (%d, %d) pairs an item with itself", s.i, s.j)
+		}
+		if s.i > s.j {
+			s.i, s.j = s.j, s.i
+		}
+		if k, ok := index[[2]int{s.i, s.j}]; ok {
+			if s.bonus > normalized[k].bonus {
+				normalized[k].bonus = s.bonus
+			}
+			continue
+		}
+		index[[2]int{s.i, s.j}] = len(normalized)
+		normalized = append(normalized, s)
+	}
+	return normalized, nil
+}
+
+// Return the value of the selected items plus the bonuses of the
+// synergies whose items are both selected.
+func quadratic_value(items []Item, synergies []synergy) int {
+	total := sum_values(items, false)
+	for _, s := range synergies {
+		if items[s.i].is_selected && items[s.j].is_selected {
+			total += s.bonus
+		}
+	}
+	return total
+}
+
+// Use exhaustive search with the synergy bonuses in the objective.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func quadratic_exhaustive_search(items []Item, allowed_weight int, synergies []synergy) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	best_items, best_value, function_calls := do_quadratic_exhaustive_search(items, allowed_weight, synergies, 0)
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return best_items, best_value, function_calls
+}
+
+func do_quadratic_exhaustive_search(items []Item, allowed_weight int, synergies []synergy, next_index int) ([]Item, int, int) {
+	if next_index >= len(items) {
+		if sum_weights(items, false) > allowed_weight {
+			return copy_items(items), -1, 1
+		}
+		return copy_items(items), quadratic_value(items, synergies), 1
+	}
+	//try to add item
+	items[next_index].is_selected = true
+	best_items, best_value, function_calls := do_quadratic_exhaustive_search(items, allowed_weight, synergies, next_index+1)
+	//try to remove item
+	items[next_index].is_selected = false
+	other_items, other_value, other_calls := do_quadratic_exhaustive_search(items, allowed_weight, synergies, next_index+1)
+	function_calls += other_calls
+	if other_value > best_value {
+		best_items = other_items
+		best_value = other_value
+	}
+	return best_items, best_value, function_calls + 1
+}
+
+// Use branch and bound with the synergy bonuses in the objective.
+// The bound adds Dantzig's bound for the undecided items to every
+// positive bonus whose items could still both be selected.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func quadratic_branch_and_bound(items []Item, allowed_weight int, synergies []synergy) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	// List each item's synergies.
+	partners := make([][]synergy, len(items))
+	for _, s := range synergies {
+		partners[s.i] = append(partners[s.i], s)
+		partners[s.j] = append(partners[s.j], s)
+	}
+	for i := range items {
+		items[i].is_selected = false
+	}
+
+	// Nothing beats the bound at the root, so the search can stop as
+	// soon as the incumbent reaches it.
+	order := density_order(items)
+	root_bound := quadratic_bound(items, order, synergies, 0, allowed_weight)
+
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	best_value, function_calls := do_quadratic_branch_and_bound(items, order, allowed_weight, synergies, partners, 0, best_selection, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_quadratic_branch_and_bound(items []Item, order []int, allowed_weight int, synergies []synergy, partners [][]synergy, next_index int, best_selection []bool, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1
+	}
+
+	if best_value >= root_bound || current_value+quadratic_bound(items, order, synergies, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	if current_weight+items[next_index].weight <= allowed_weight {
+		// Add the bonuses with the items selected so far.
+		added_value := items[next_index].value
+		for _, s := range partners[next_index] {
+			other := s.i + s.j - next_index
+			if other < next_index && items[other].is_selected {
+				added_value += s.bonus
+			}
+		}
+		items[next_index].is_selected = true
+		best_value, calls = do_quadratic_branch_and_bound(items, order, allowed_weight, synergies, partners, next_index+1, best_selection, best_value,
+			current_value+added_value, current_weight+items[next_index].weight, root_bound)
+		function_calls += calls
+	}
+
+	items[next_index].is_selected = false
+	best_value, calls = do_quadratic_branch_and_bound(items, order, allowed_weight, synergies, partners, next_index+1, best_selection, best_value,
+		current_value, current_weight, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Return Dantzig's bound for the undecided items plus the bonuses we
+// can still get: those with a selected or undecided item at each end,
+// and at least one undecided end.
+func quadratic_bound(items []Item, order []int, synergies []synergy, next_index, remaining_weight int) int {
+	bound := dantzig_bound(items, order, next_index, remaining_weight)
+	for _, s := range synergies {
+		if s.bonus > 0 && s.j >= next_index && (s.i >= next_index || items[s.i].is_selected) {
+			bound += s.bonus
+		}
+	}
+	return bound
+}
+
+// Give each item a worst-case weight up to max_deviation above its weight.
+func make_weight_intervals(items []Item, max_deviation int) {
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	for i := range items {
+		items[i].high_weight = items[i].weight + random.Intn(max_deviation+1)
+	}
+}
+
+// Make sure every weight interval is [weight, high_weight] with weight <= high_weight.
+func check_weight_intervals(items []Item) error {
+	for _, item := range items {
+		if item.high_weight < item.weight {
+			return fmt.Errorf("item %d has worst-case weight %d below its weight %d",
+				item.id, item.high_weight, item.weight)
+		}
+	}
+	return nil
+}
+
+// Return the largest weight the selected items can have when at most
+// gamma of them take their worst-case weight, and the ids of the
+// items that take it.
+func robust_weight(items []Item, gamma int) (int, []int) {
+	total := sum_weights(items, false)
+	var selected []Item
+	for _, item := range items {
+		if item.is_selected {
+			selected = append(selected, item)
+		}
+	}
+	// The items with the largest deviations drive the penalty.
+	sort.SliceStable(selected, func(a, b int) bool {
+		return selected[a].high_weight-selected[a].weight > selected[b].high_weight-selected[b].weight
+	})
+	var risky []int
+	for k := 0; k < gamma && k < len(selected); k++ {
+		deviation := selected[k].high_weight - selected[k].weight
+		if deviation == 0 {
+			break
+		}
+		total += deviation
+		risky = append(risky, selected[k].id)
+	}
+	return total, risky
+}
+
+// Find the best selection that fits even if any gamma of its items take
+// their worst-case weight. Following Bertsimas and Sim, for each threshold
+// t in {0} and the deviations d, solve an ordinary knapsack where each
+// item weighs weight + max(d - t, 0) and the capacity is
+// allowed_weight - gamma*t. The best of these n+1 solutions is optimal.
+// gamma = 0 is the nominal knapsack and gamma = len(items) the worst case.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func robust_knapsack(items []Item, allowed_weight, gamma int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	thresholds := []int{0}
+	seen := map[int]bool{0: true}
+	for _, item := range items {
+		deviation := item.high_weight - item.weight
+		if !seen[deviation] {
+			seen[deviation] = true
+			thresholds = append(thresholds, deviation)
+		}
+	}
+
+	var best_items []Item
+	best_value := -1
+	function_calls := 0
+	for _, threshold := range thresholds {
+		capacity := allowed_weight - gamma*threshold
+		if capacity < 0 {
+			continue
+		}
+		shifted_items := copy_items(items)
+		for i := range shifted_items {
+			if deviation := items[i].high_weight - items[i].weight; deviation > threshold {
+				shifted_items[i].weight += deviation - threshold
+			}
+		}
+		solution, _, calls := dynamic_programming(shifted_items, capacity)
+		function_calls += calls
+
+		// Score the selection with the original weights.
+		for i := range items {
+			items[i].is_selected = solution[i].is_selected
+		}
+		if value := sum_values(items, false); value > best_value {
+			best_value = value
+			best_items = copy_items(items)
+		}
+	}
+	if best_items == nil {
+		for i := range items {
+			items[i].is_selected = false
+		}
+		return copy_items(items), 0, function_calls
+	}
+	return best_items, best_value, function_calls
+}
+
+func run_robust(items []Item, allowed_weight, gamma int) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls := robust_knapsack(test_items, allowed_weight, gamma)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_selected(solution)
+	worst_weight, risky := robust_weight(solution, gamma)
+	sort.Ints(risky)
+	fmt.Printf("Value: %d, Weight: %d, Worst-case weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), worst_weight, function_calls)
+	fmt.Printf("Risky items: %v\n", risky)
+	report_mismatch(verify_solution(items, solution, total_value, allowed_weight, func(solution []Item) error {
+		if worst_weight > allowed_weight {
+			return fmt.Errorf("the solution weighs up to %d, more than the allowed weight %d", worst_weight, allowed_weight)
+		}
+		return nil
+	}))
+	fmt.Println()
+}
+
+func run_target(alg func([]Item, int, int) ([]Item, int, int, bool), items []Item, allowed_weight, target int) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls, target_reached := alg(test_items, allowed_weight, target)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_selected(solution)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), function_calls)
+	fmt.Printf("Target reached: %v\n", target_reached)
+	report_mismatch(verify_solution(items, solution, total_value, allowed_weight, func(solution []Item) error {
+		if target_reached != (total_value >= target) {
+			return fmt.Errorf("the algorithm said the target was reached: %v, but the value %d and target %d disagree", target_reached, total_value, target)
+		}
+		return nil
+	}))
+	fmt.Println()
+}
+
+// Use exhaustive search, but stop as soon as a solution is worth at
+// least target. If none is, search everything and return the optimum.
+// Return the assignment, value of that assignment, the number of
+// function calls we made, and whether the value reaches target.
+func target_exhaustive_search(items []Item, allowed_weight, target int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, target <= 0
+	}
+	best_items, best_value, function_calls, reached := do_target_exhaustive_search(items, allowed_weight, target, 0)
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls, target <= 0
+	}
+	return best_items, best_value, function_calls, reached
+}
+
+func do_target_exhaustive_search(items []Item, allowed_weight, target, next_index int) ([]Item, int, int, bool) {
+	if next_index >= len(items) {
+		value := solution_value(items, allowed_weight)
+		return copy_items(items), value, 1, value >= 0 && value >= target
+	}
+	//try to add item
+	items[next_index].is_selected = true
+	best_items, best_value, function_calls, reached := do_target_exhaustive_search(items, allowed_weight, target, next_index+1)
+	if reached {
+		return best_items, best_value, function_calls + 1, true
+	}
+	//try to remove item
+	items[next_index].is_selected = false
+	other_items, other_value, other_calls, reached := do_target_exhaustive_search(items, allowed_weight, target, next_index+1)
+	function_calls += other_calls
+	if other_value > best_value {
+		best_items = other_items
+		best_value = other_value
+	}
+	return best_items, best_value, function_calls + 1, reached
+}
+
+// Use branch and bound, but stop as soon as a solution is worth at
+// least target. If none is, search everything and return the optimum.
+// Return the assignment, value of that assignment, the number of
+// function calls we made, and whether the value reaches target.
+func target_branch_and_bound(items []Item, allowed_weight, target int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, target <= 0
+	}
+	for i := range items {
+		items[i].is_selected = false
+	}
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value. It already reaches a
+	// target of 0 or less.
+	best_selection := make([]bool, len(items))
+	if target <= 0 {
+		return apply_selection(items, best_selection), 0, 0, true
+	}
+	// Nothing is worth more than all the items, so the search can stop
+	// as soon as the incumbent is worth that much.
+	root_bound := sum_values(items, true)
+	best_value, function_calls, reached := do_target_branch_and_bound(items, allowed_weight, target, 0, best_selection, 0, 0, 0, root_bound, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls, reached
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value, the number of function calls we made, and
+// whether the best value reaches target, which ends the search.
+func do_target_branch_and_bound(items []Item, allowed_weight, target, next_index int, best_selection []bool, best_value, current_value, current_weight, remaining_value, root_bound int) (int, int, bool) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
+		}
+		return best_value, 1, best_value >= target
+	}
+
+	if best_value >= root_bound || current_value+remaining_value <= best_value {
+		return best_value, 1, false
+	}
+
+	function_calls := 1
+	var calls int
+	var reached bool
+
+	if current_weight+items[next_index].weight <= allowed_weight {
+		items[next_index].is_selected = true
+		best_value, calls, reached = do_target_branch_and_bound(items, allowed_weight, target, next_index+1, best_selection, best_value,
+			current_value+items[next_index].value, current_weight+items[next_index].weight, remaining_value-items[next_index].value, root_bound)
+		items[next_index].is_selected = false
+		function_calls += calls
+		if reached {
+			return best_value, function_calls, true
+		}
+	}
+
+	best_value, calls, reached = do_target_branch_and_bound(items, allowed_weight, target, next_index+1, best_selection, best_value,
+		current_value, current_weight, remaining_value-items[next_index].value, root_bound)
+	return best_value, function_calls + calls, reached
+}
+
+// Use dynamic programming, but stop filling rows as soon as the items
+// so far can reach target. If they never do, fill every row and return
+// the optimum.
+// Return the assignment, value of that assignment, the number of
+// table cells we computed, and whether the value reaches target.
+func target_dynamic_programming(items []Item, allowed_weight, target int) ([]Item, int, int, bool) {
+	items = copy_items(items)
+	// Only the empty selection fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0, target <= 0
+	}
+	// Row i holds the best values using the first i items.
+	solution_value_array := getSliceOfSlices(len(items)+1, allowed_weight+1)
+	rows := 0
+	for rows < len(items) && solution_value_array[rows][allowed_weight] < target {
+		item := items[rows]
+		for w := 0; w <= allowed_weight; w++ {
+			best := solution_value_array[rows][w]
+			if item.weight <= w && solution_value_array[rows][w-item.weight]+item.value > best {
+				best = solution_value_array[rows][w-item.weight] + item.value
+			}
+			solution_value_array[rows+1][w] = best
+		}
+		rows++
+	}
+
+	// Items after the last row we filled stay unselected.
+	for i := range items {
+		items[i].is_selected = false
+	}
+	w := allowed_weight
+	for i := rows; i >= 1; i-- {
+		if solution_value_array[i][w] != solution_value_array[i-1][w] {
+			items[i-1].is_selected = true
+			w -= items[i-1].weight
+		}
+	}
+	total_value := solution_value_array[rows][allowed_weight]
+	return copy_items(items), total_value, rows * (allowed_weight + 1), total_value >= target
+}
+
+// Put each item in a random category.
+func make_categories(items []Item, names []string) {
+	random := rand.New(rand.NewSource(1337)) // Initialize with a fixed seed
+	for i := range items {
+		items[i].category = names[random.Intn(len(names))]
+	}
+}
+
+// Return the weight of the selected items in each category.
+func category_weights(items []Item) map[string]int {
+	weights := make(map[string]int)
+	for _, item := range items {
+		if item.is_selected {
+			weights[item.category] += item.weight
+		}
+	}
+	return weights
+}
+
+// Return true if no category is over its limit.
+// Categories without a limit can hold any weight.
+func within_category_limits(items []Item, limits map[string]int) bool {
+	for category, weight := range category_weights(items) {
+		if limit, ok := limits[category]; ok && weight > limit {
+			return false
+		}
+	}
+	return true
+}
+
+// Return the categories, sorted, that have a limit the category's
+// items can exceed. Other limits never matter.
+func binding_categories(items []Item, limits map[string]int) []string {
+	totals := make(map[string]int)
+	for _, item := range items {
+		totals[item.category] += item.weight
+	}
+	var binding []string
+	for category, limit := range limits {
+		if totals[category] > limit {
+			binding = append(binding, category)
+		}
+	}
+	sort.Strings(binding)
+	return binding
+}
+
+// Return the limits as "category: limit" pairs in category order.
+func format_limits(limits map[string]int) string {
+	var categories []string
+	for category := range limits {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var pairs []string
+	for _, category := range categories {
+		pairs = append(pairs, fmt.Sprintf("%s: %d", category, limits[category]))
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// Print the weight used and the limit of each category.
+func print_category_usage(items []Item, limits map[string]int) {
+	weights := category_weights(items)
+	var categories []string
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if !seen[item.category] {
+			seen[item.category] = true
+			categories = append(categories, item.category)
+		}
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		if limit, ok := limits[category]; ok {
+			fmt.Printf("%s: %d/%d ", category, weights[category], limit)
+		} else {
+			fmt.Printf("%s: %d ", category, weights[category])
+		}
+	}
+	fmt.Println()
+}
+
+func run_categories(alg func([]Item, int, map[string]int) ([]Item, int, int), items []Item, allowed_weight int, limits map[string]int) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls := alg(test_items, allowed_weight, limits)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_selected(solution)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false), function_calls)
+	print_category_usage(solution, limits)
+	report_mismatch(verify_solution(items, solution, total_value, allowed_weight, within_limits(limits)))
+	fmt.Println()
+}
+
+// Check that no category weighs more than its limit.
+func within_limits(limits map[string]int) constraint_check {
+	return func(solution []Item) error {
+		weights := category_weights(solution)
+		var categories []string
+		for category := range limits {
+			categories = append(categories, category)
+		}
+		sort.Strings(categories)
+		for _, category := range categories {
+			if weights[category] > limits[category] {
+				return fmt.Errorf("category %s weighs %d, more than its limit %d", category, weights[category], limits[category])
+			}
+		}
+		return nil
+	}
+}
+
+// Use exhaustive search with a weight limit for each category.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func category_exhaustive_search(items []Item, allowed_weight int, limits map[string]int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	best_items, best_value, function_calls := do_category_exhaustive_search(items, allowed_weight, limits, 0)
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return best_items, best_value, function_calls
+}
+
+func do_category_exhaustive_search(items []Item, allowed_weight int, limits map[string]int, next_index int) ([]Item, int, int) {
+	if next_index >= len(items) {
+		if !within_category_limits(items, limits) {
+			return copy_items(items), -1, 1
+		}
+		return copy_items(items), solution_value(items, allowed_weight), 1
+	}
+	//try to add item
+	items[next_index].is_selected = true
+	best_items, best_value, function_calls := do_category_exhaustive_search(items, allowed_weight, limits, next_index+1)
+	//try to remove item
+	items[next_index].is_selected = false
+	other_items, other_value, other_calls := do_category_exhaustive_search(items, allowed_weight, limits, next_index+1)
+	function_calls += other_calls
+	if other_value > best_value {
+		best_items = other_items
+		best_value = other_value
+	}
+	return best_items, best_value, function_calls + 1
+}
+
+// Use branch and bound with a weight limit for each category.
+// We keep the running weight of each category and only add an item
+// if both its category and the knapsack have room. Dantzig's bound
+// ignores the categories, so it still never underestimates.
+// Return the best assignment, value of that assignment,
+// and the number of function calls we made.
+func category_branch_and_bound(items []Item, allowed_weight int, limits map[string]int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	for i := range items {
+		items[i].is_selected = false
+	}
+	// The empty selection is the starting incumbent, so we always have
+	// a solution that matches the best value.
+	best_selection := make([]bool, len(items))
+	// Nothing beats Dantzig's bound at the root, which ignores the
+	// categories, so the search can stop as soon as the incumbent
+	// reaches it.
+	order := density_order(items)
+	root_bound := dantzig_bound(items, order, 0, allowed_weight)
+	best_value, function_calls := do_category_branch_and_bound(items, order, allowed_weight, limits, make(map[string]int), 0, best_selection, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_category_branch_and_bound(items []Item, order []int, allowed_weight int, limits, current_weights map[string]int, next_index int, best_selection []bool, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
 			}
 		}
+		return best_value, 1
 	}
-	for i := 0; i < len(items); i++ {
+
+	if best_value >= root_bound || current_value+dantzig_bound(items, order, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	item := items[next_index]
+	limit, limited := limits[item.category]
+	if current_weight+item.weight <= allowed_weight && (!limited || current_weights[item.category]+item.weight <= limit) {
+		items[next_index].is_selected = true
+		current_weights[item.category] += item.weight
+		best_value, calls = do_category_branch_and_bound(items, order, allowed_weight, limits, current_weights, next_index+1, best_selection, best_value,
+			current_value+item.value, current_weight+item.weight, root_bound)
+		current_weights[item.category] -= item.weight
+		items[next_index].is_selected = false
+		function_calls += calls
+	}
+
+	best_value, calls = do_category_branch_and_bound(items, order, allowed_weight, limits, current_weights, next_index+1, best_selection, best_value,
+		current_value, current_weight, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Return an error unless at most one category limit can bind,
+// which is all category_dynamic_programming handles.
+func check_category_dynamic_programming(items []Item, limits map[string]int) error {
+	if binding := binding_categories(items, limits); len(binding) > 1 {
+		return fmt.Errorf("dynamic programming handles one binding category limit, not %d %v", len(binding), binding)
+	}
+	return nil
+}
+
+// Use dynamic programming with a weight limit for one category.
+// The binding category's weight becomes the volume of the
+// two-dimensional knapsack. Call check_category_dynamic_programming
+// first: limits on more than one binding category are not supported.
+// Return the best assignment, value of that assignment,
+// and the number of table cells we computed.
+func category_dynamic_programming(items []Item, allowed_weight int, limits map[string]int) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	binding := binding_categories(items, limits)
+	if len(binding) == 0 {
+		return dynamic_programming(items, allowed_weight)
+	}
+
+	for i := range items {
+		items[i].volume = 0
+		if items[i].category == binding[0] {
+			items[i].volume = items[i].weight
+		}
+	}
+	return two_dimensional_dynamic_programming(items, allowed_weight, limits[binding[0]])
+}
+
+// Split the items into the selected and the unselected ones so the two
+// groups' values are as close as possible, ignoring weight. reachable[i]
+// is a bitset of the values some selection of the first i items is
+// worth. The selected group gets the reachable value nearest half the
+// total from below, so the unselected group is worth at least as much.
+// Return the split, the difference between the groups' values,
+// and the number of table cells we computed.
+func partition_dynamic_programming(items []Item) ([]Item, int, int) {
+	items = copy_items(items)
+	total_value := sum_values(items, true)
+	num_words := total_value/64 + 1
+	reachable := make([][]uint64, len(items)+1)
+	reachable[0] = make([]uint64, num_words)
+	reachable[0][0] = 1
+	for i := 1; i <= len(items); i++ {
+		// Shift the previous row left by the item's value and OR it in.
+		reachable[i] = make([]uint64, num_words)
+		shift_or(reachable[i], reachable[i-1], items[i-1].value)
+	}
+
+	// The empty selection is worth 0, so some value is always reachable.
+	best_value := total_value / 2
+	for !is_reachable(reachable[len(items)], best_value) {
+		best_value--
+	}
+
+	// An item is selected if the value can't be reached without it.
+	v := best_value
+	for i := len(items); i >= 1; i-- {
+		items[i-1].is_selected = !is_reachable(reachable[i-1], v)
+		if items[i-1].is_selected {
+			v -= items[i-1].value
+		}
+	}
+	return copy_items(items), total_value - 2*best_value, len(items) * (total_value + 1)
+}
+
+func run_partition(items []Item) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, difference, function_calls := partition_dynamic_programming(test_items)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	fmt.Print("Group 1: ")
+	print_selected(solution)
+	other := copy_items(solution)
+	for i := range other {
+		other[i].is_selected = !other[i].is_selected
+	}
+	fmt.Print("Group 2: ")
+	print_selected(other)
+	fmt.Printf("Values: %d and %d, Difference: %d, Calls: %d\n",
+		sum_values(solution, false), sum_values(other, false), difference, function_calls)
+	fmt.Println()
+}
+
+// Return the setup costs as "category: weight w, value v" pairs in
+// category order.
+func format_setups(setups map[string]setup_cost) string {
+	var categories []string
+	for category := range setups {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var pairs []string
+	for _, category := range categories {
+		pairs = append(pairs, fmt.Sprintf("%s: weight %d, value %d", category, setups[category].weight, setups[category].value))
+	}
+	return strings.Join(pairs, "; ")
+}
+
+// Make sure no setup cost is negative, which keeps the bounds admissible.
+// Check the categories in sorted order so we always report the same one.
+func check_setups(setups map[string]setup_cost) error {
+	var categories []string
+	for category := range setups {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		if setup := setups[category]; setup.weight < 0 || setup.value < 0 {
+			return fmt.Errorf("category %s has a negative setup cost %v", category, setup)
+		}
+	}
+	return nil
+}
+
+// Return the categories, sorted, whose setup cost the selection pays
+// and the total setup weight and value.
+func paid_setups(items []Item, setups map[string]setup_cost) ([]string, int, int) {
+	var paid []string
+	setup_weight, setup_value := 0, 0
+	for category := range category_weights(items) {
+		if setup, ok := setups[category]; ok {
+			paid = append(paid, category)
+			setup_weight += setup.weight
+			setup_value += setup.value
+		}
+	}
+	sort.Strings(paid)
+	return paid, setup_weight, setup_value
+}
+
+func run_setups(alg func([]Item, int, map[string]setup_cost) ([]Item, int, int), items []Item, allowed_weight int, setups map[string]setup_cost) {
+	// Copy the items so the run isn't influenced by a previous run.
+	test_items := copy_items(items)
+
+	start := time.Now()
+
+	// Run the algorithm.
+	solution, total_value, function_calls := alg(test_items, allowed_weight, setups)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("Elapsed: %f\n", elapsed.Seconds())
+	print_selected(solution)
+	paid, setup_weight, setup_value := paid_setups(solution, setups)
+	fmt.Printf("Value: %d, Weight: %d, Calls: %d\n",
+		total_value, sum_weights(solution, false)+setup_weight, function_calls)
+	fmt.Printf("Setups paid: %v, Setup weight: %d, Setup value: %d\n", paid, setup_weight, setup_value)
+	// The claimed value and the capacity include the setups, so compare without them.
+	report_mismatch(verify_solution(items, solution, total_value+setup_value, allowed_weight-setup_weight, nil))
+	fmt.Println()
+}
+
+// Use exhaustive search where selecting a category's first item costs
+// that category's setup weight and value.
+// Return the best assignment, value of that assignment after setup
+// costs, and the number of function calls we made.
+func setup_exhaustive_search(items []Item, allowed_weight int, setups map[string]setup_cost) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	best_items, best_value, function_calls := do_setup_exhaustive_search(items, allowed_weight, setups, 0)
+	if best_value < 0 {
+		return empty_solution(items), 0, function_calls
+	}
+	return best_items, best_value, function_calls
+}
+
+func do_setup_exhaustive_search(items []Item, allowed_weight int, setups map[string]setup_cost, next_index int) ([]Item, int, int) {
+	if next_index >= len(items) {
+		_, setup_weight, setup_value := paid_setups(items, setups)
+		if sum_weights(items, false)+setup_weight > allowed_weight {
+			return copy_items(items), -1, 1
+		}
+		return copy_items(items), sum_values(items, false) - setup_value, 1
+	}
+	//try to add item
+	items[next_index].is_selected = true
+	best_items, best_value, function_calls := do_setup_exhaustive_search(items, allowed_weight, setups, next_index+1)
+	//try to remove item
+	items[next_index].is_selected = false
+	other_items, other_value, other_calls := do_setup_exhaustive_search(items, allowed_weight, setups, next_index+1)
+	function_calls += other_calls
+	if other_value > best_value {
+		best_items = other_items
+		best_value = other_value
+	}
+	return best_items, best_value, function_calls + 1
+}
+
+// Use branch and bound where selecting a category's first item costs
+// that category's setup weight and value. We count the selected items
+// in each category to know which setups are paid. Dantzig's bound
+// ignores the setups, which only make things worse, so it never
+// underestimates.
+// Return the best assignment, value of that assignment after setup
+// costs, and the number of function calls we made.
+func setup_branch_and_bound(items []Item, allowed_weight int, setups map[string]setup_cost) ([]Item, int, int) {
+	items = copy_items(items)
+	// Nothing fits in a negative capacity.
+	if allowed_weight < 0 {
+		return empty_solution(items), 0, 0
+	}
+	for i := range items {
 		items[i].is_selected = false
 	}
-	//Find the items in the solution.
-	i := len(items) - 1
-	j := allowed_weight
-	for i >= 0 {
-		if prev_weight_array[i][j] != j {
-			items[i].is_selected = true
-			j = prev_weight_array[i][j]
+	// The empty selection pays no setups and is worth 0. It is the
+	// starting incumbent, so we always have a solution that matches the
+	// best value.
+	best_selection := make([]bool, len(items))
+	// Nothing beats Dantzig's bound at the root, so the search can stop
+	// as soon as the incumbent reaches it.
+	order := density_order(items)
+	root_bound := dantzig_bound(items, order, 0, allowed_weight)
+	best_value, function_calls := do_setup_branch_and_bound(items, order, allowed_weight, setups, make(map[string]int), 0, best_selection, 0, 0, 0, root_bound)
+	return apply_selection(items, best_selection), best_value, function_calls
+}
+
+// When a leaf beats best_value, record its selection in best_selection.
+// Return the new best value and the number of function calls we made.
+func do_setup_branch_and_bound(items []Item, order []int, allowed_weight int, setups map[string]setup_cost, open_counts map[string]int, next_index int, best_selection []bool, best_value, current_value, current_weight, root_bound int) (int, int) {
+	if next_index >= len(items) {
+		if current_value > best_value {
+			best_value = current_value
+			for i := range items {
+				best_selection[i] = items[i].is_selected
+			}
 		}
-		i--
+		return best_value, 1
+	}
+
+	if best_value >= root_bound || current_value+dantzig_bound(items, order, next_index, allowed_weight-current_weight) <= best_value {
+		return best_value, 1
+	}
+
+	function_calls := 1
+	var calls int
+
+	// The category's first item pays its setup.
+	item := items[next_index]
+	added_weight, added_value := item.weight, item.value
+	if setup, ok := setups[item.category]; ok && open_counts[item.category] == 0 {
+		added_weight += setup.weight
+		added_value -= setup.value
+	}
+	if current_weight+added_weight <= allowed_weight {
+		items[next_index].is_selected = true
+		open_counts[item.category]++
+		best_value, calls = do_setup_branch_and_bound(items, order, allowed_weight, setups, open_counts, next_index+1, best_selection, best_value,
+			current_value+added_value, current_weight+added_weight, root_bound)
+		open_counts[item.category]--
+		items[next_index].is_selected = false
+		function_calls += calls
 	}
-	return items, sum_values(items, false), 1
+
+	best_value, calls = do_setup_branch_and_bound(items, order, allowed_weight, setups, open_counts, next_index+1, best_selection, best_value,
+		current_value, current_weight, root_bound)
+	return best_value, function_calls + calls
+}
+
+// Say that we skip an algorithm because the instance has more items
+// than limit, the constant named limit_name. Raise the constant to run
+// it anyway: without pruning, its search tree has 2^(n+1) - 1 nodes.
+func print_too_many_items(algorithm, limit_name string, limit, num_items int) {
+	fmt.Printf("Too many items for %s: %d items, more than %s = %d\n", algorithm, num_items, limit_name, limit)
+	fmt.Printf("Its search tree has up to 2^%d - 1 nodes\n", num_items+1)
+	fmt.Println()
 }
 
 func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// Run the demo with the given command-line arguments and return the
+// exit status: 1 if some solution failed verification, 2 for bad
+// arguments.
+func run(args []string) int {
+	// The parallel algorithms follow GOMAXPROCS unless -workers says
+	// otherwise. With one worker they run the serial algorithms.
+	flags := flag.NewFlagSet("knapsack", flag.ContinueOnError)
+	workers_flag := flags.Int("workers", runtime.GOMAXPROCS(0), "number of workers for the parallel algorithms")
+	concurrent := flags.Bool("concurrent", false, "run the algorithms for the basic knapsack at the same time and compare them")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	verification_failed = false
+
 	items := make_items(num_items, min_value, max_value, min_weight, max_weight)
-	allowed_weight = sum_weights(items, true) / 2
+	allowed_weight := sum_weights(items, true) / 2
 
 	// Display basic parameters.
 	fmt.Println("*** Parameters ***")
@@ -378,36 +5157,416 @@ func main() {
 	fmt.Printf("Allowed weight: %d\n", allowed_weight)
 	fmt.Println()
 
+	// Track the optimum found by the exact algorithms, and an upper bound
+	// on it in case none of them runs.
+	optimum := -1
+	upper_bound := dantzig_bound(items, density_order(items), 0, allowed_weight)
+
+	// Every parallel algorithm uses the same number of workers. Fewer
+	// than one can't work, and more than max_workers_per_cpu per CPU
+	// only add overhead, so we clamp the number and say so.
+	workers := *workers_flag
+	if limit := max_workers_per_cpu * runtime.NumCPU(); workers > limit {
+		fmt.Printf("-workers %d is more than %d per CPU, using %d workers\n\n", workers, max_workers_per_cpu, limit)
+		workers = limit
+	} else if workers < 1 {
+		fmt.Printf("-workers %d is less than 1, using 1 worker\n\n", workers)
+		workers = 1
+	}
+
+	// Run the algorithms at the same time instead of one by one.
+	if *concurrent {
+		results := run_concurrently(concurrent_solvers(items, allowed_weight, workers), items, allowed_weight)
+		fmt.Println("*** Comparison ***")
+		print_comparison(results)
+		if verification_failed {
+			fmt.Println("*** Some solutions failed verification ***")
+			return 1
+		}
+		return 0
+	}
+
 	// Exhaustive search
-	if num_items > 25 { // Only run exhaustive search if num_items <= 25.
-		fmt.Println("Too many items for exhaustive search\n")
+	if num_items > max_exhaustive_items {
+		print_too_many_items("exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
 	} else {
 		fmt.Println("*** Exhaustive Search ***")
-		run_algorithm(exhaustive_search, items, allowed_weight)
+		optimum = run_algorithm(exhaustive_search, items, allowed_weight)
+
+		fmt.Printf("*** Parallel exhaustive search (%d workers) ***\n", workers)
+		run_algorithm(func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return parallel_exhaustive_search(items, allowed_weight, workers)
+		}, items, allowed_weight)
 	}
 
 	// branch_and_bound search
-	if num_items > 45 { // Only run branch_and_bound search if num_items <= 25.
-		fmt.Println("Too many items for branch_and_bound search\n")
+	branch_and_bound_calls := -1
+	if num_items > max_branch_and_bound_items {
+		print_too_many_items("branch and bound", "max_branch_and_bound_items", max_branch_and_bound_items, num_items)
 	} else {
 		fmt.Println("*** branch_and_bound ***")
-		run_algorithm(branch_and_bound, items, allowed_weight)
+		optimum = run_solver(func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+			solution, total_value, function_calls, stats := branch_and_bound(items, allowed_weight)
+			branch_and_bound_calls = function_calls
+			return solution, total_value, function_calls, stats
+		}, items, allowed_weight, nil)
+	}
+
+	// How big a tree branch_and_bound faces
+	fmt.Println("*** Tree size estimate ***")
+	run_estimate(items, allowed_weight, branch_and_bound_calls)
+
+	// Branch and bound with each branching order
+	if num_items > max_branch_and_bound_items {
+		print_too_many_items("ordered branch and bound", "max_branch_and_bound_items", max_branch_and_bound_items, num_items)
+	} else {
+		for _, branch_order := range branch_orders {
+			fmt.Printf("*** Branch and bound, %s order ***\n", branch_order)
+			run_algorithm(func(items []Item, allowed_weight int) ([]Item, int, int) {
+				return ordered_branch_and_bound(items, allowed_weight, branch_order)
+			}, items, allowed_weight)
+		}
 	}
 	// Rod's technique
-	if num_items > 85 { // Only use Rod's technique if num_items <= 85.
-		fmt.Println("Too many items for Rod's technique\n")
+	if num_items > max_rods_items {
+		print_too_many_items("Rod's technique", "max_rods_items", max_rods_items, num_items)
 	} else {
 		fmt.Println("*** Rod's technique ***")
-		run_algorithm(rods_technique, items, allowed_weight)
+		optimum = run_solver(rods_technique, items, allowed_weight, nil)
 	}
 	// Rod's sorted technique
-	if num_items > 350 { // Only use Rod's technique if num_items <= 85.
-		fmt.Println("Too many items for Rod's sorted  technique\n")
+	if num_items > max_rods_sorted_items {
+		print_too_many_items("Rod's sorted technique", "max_rods_sorted_items", max_rods_sorted_items, num_items)
 	} else {
 		fmt.Println("*** Rod's sorted technique ***")
-		run_algorithm(rods_technique_sorted, items, allowed_weight)
+		optimum = run_solver(rods_technique_sorted, items, allowed_weight, nil)
+
+		fmt.Printf("*** Parallel Rod's technique (%d workers) ***\n", workers)
+		run_solver(func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+			return parallel_rods_technique(items, allowed_weight, workers)
+		}, items, allowed_weight, nil)
 	}
 	// Dynamic programming
-	fmt.Println("*** Dynamic programming ***")
-	run_algorithm(dynamic_programming, items, allowed_weight)
+	if err := check_dynamic_programming_size(items, allowed_weight); err != nil {
+		fmt.Printf("Can't use dynamic programming: %v\n\n", err)
+	} else {
+		fmt.Println("*** Dynamic programming ***")
+		optimum = run_algorithm(dynamic_programming, items, allowed_weight)
+
+		solution, _, _ := dynamic_programming(items, allowed_weight)
+		fmt.Println("*** Knapsack filled by dynamic programming ***")
+		fmt.Println(render_knapsack(solution, allowed_weight, knapsack_width))
+		fmt.Println()
+
+		fmt.Println("*** Why items were left out ***")
+		for i := range solution {
+			if !solution[i].is_selected {
+				fmt.Println(explain_item(solution, allowed_weight, i))
+			}
+		}
+		print_summary(solution, summarize_solution(solution, allowed_weight))
+		fmt.Println()
+	}
+
+	// Parallel dynamic programming only splits tables of at least
+	// parallel_dp_min_cells cells, so compare it with the serial one on
+	// more items.
+	dp_items := make_items(parallel_dp_items, min_value, max_value, min_weight, max_weight)
+	dp_weight := sum_weights(dp_items, true) / 2
+	if err := check_dynamic_programming_size(dp_items, dp_weight); err != nil {
+		fmt.Printf("Can't use parallel dynamic programming: %v\n\n", err)
+	} else {
+		fmt.Printf("*** Dynamic programming (%d items, %d cells) ***\n", parallel_dp_items, parallel_dp_items*(dp_weight+1))
+		run_algorithm(dynamic_programming, dp_items, dp_weight)
+
+		fmt.Printf("*** Parallel dynamic programming (%d items, %d workers) ***\n", parallel_dp_items, workers)
+		run_algorithm(func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return parallel_dynamic_programming(items, allowed_weight, workers)
+		}, dp_items, dp_weight)
+	}
+
+	// Dynamic programming on the items as they are generated
+	fmt.Println("*** Streamed dynamic programming ***")
+	run_streamed(new_random_item_source(num_items, min_value, max_value, min_weight, max_weight), allowed_weight, optimum)
+
+	// Hill climbing
+	fmt.Println("*** Hill climbing ***")
+	run_heuristic(hill_climbing, items, allowed_weight, optimum, upper_bound)
+
+	// Beam search
+	fmt.Println("*** Beam search ***")
+	run_heuristic(beam_search, items, allowed_weight, optimum, upper_bound)
+
+	// GRASP
+	fmt.Println("*** GRASP ***")
+	run_heuristic(grasp, items, allowed_weight, optimum, upper_bound)
+
+	// Randomized rounding
+	fmt.Println("*** Randomized rounding ***")
+	run_heuristic(randomized_rounding, items, allowed_weight, optimum, upper_bound)
+
+	// Large neighborhood search
+	fmt.Println("*** Large neighborhood search ***")
+	run_heuristic(large_neighborhood_search, items, allowed_weight, optimum, upper_bound)
+
+	// Dynamic programming on weights divided by scale_factor
+	fmt.Printf("*** Scaled dynamic programming (k = %d) ***\n", scale_factor)
+	run_heuristic(func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+		return scaled_dynamic_programming(items, allowed_weight, scale_factor)
+	}, items, allowed_weight, optimum, upper_bound)
+
+	// Heuristic first, then branch and bound to prove optimality
+	fmt.Println("*** Auto exact ***")
+	run_solver(auto_exact, items, allowed_weight, nil)
+
+	// Bounded knapsack: the same items with up to max_quantity copies each.
+	bounded_items := copy_items(items)
+	make_quantities(bounded_items, max_quantity)
+	fmt.Println("*** Bounded knapsack ***")
+	fmt.Printf("Total value: %d\n", sum_values(bounded_items, true))
+	fmt.Printf("Total weight: %d\n", sum_weights(bounded_items, true))
+	fmt.Println()
+
+	fmt.Println("*** Bounded branch and bound ***")
+	run_solver(no_stats(bounded_branch_and_bound), bounded_items, allowed_weight, within_quantities)
+
+	fmt.Println("*** Bounded dynamic programming ***")
+	run_solver(no_stats(bounded_dynamic_programming), bounded_items, allowed_weight, within_quantities)
+
+	// Unbounded knapsack: any number of copies of each item.
+	if err := check_unbounded(items); err != nil {
+		fmt.Printf("Can't solve the unbounded knapsack: %v\n\n", err)
+	} else {
+		fmt.Println("*** Unbounded branch and bound ***")
+		run_algorithm(unbounded_branch_and_bound, items, allowed_weight)
+
+		fmt.Println("*** Unbounded dynamic programming ***")
+		run_algorithm(unbounded_dynamic_programming, items, allowed_weight)
+	}
+
+	// Multiple-choice knapsack: pick exactly one item from each group.
+	group_items := copy_items(items)
+	make_groups(group_items, num_groups)
+	if err := check_multiple_choice(group_items, allowed_weight); err != nil {
+		fmt.Printf("Can't solve the multiple-choice knapsack: %v\n\n", err)
+	} else {
+		fmt.Println("*** Multiple-choice dynamic programming ***")
+		run_constrained(multiple_choice_dynamic_programming, group_items, allowed_weight, "picks one item from each group", one_per_group)
+	}
+
+	// Two-dimensional knapsack: limit the volume as well as the weight.
+	volume_items := copy_items(items)
+	make_volumes(volume_items, min_volume, max_volume)
+	allowed_volume := sum_volumes(volume_items, true) / 2
+	fmt.Println("*** Two-dimensional knapsack ***")
+	fmt.Printf("Total volume: %d\n", sum_volumes(volume_items, true))
+	fmt.Printf("Allowed volume: %d\n", allowed_volume)
+	fmt.Println()
+
+	fmt.Println("*** Two-dimensional branch and bound ***")
+	run_solver(no_stats(func(items []Item, allowed_weight int) ([]Item, int, int) {
+		return two_dimensional_branch_and_bound(items, allowed_weight, allowed_volume)
+	}), volume_items, allowed_weight, within_volume(allowed_volume))
+
+	if err := check_two_dimensional_size(volume_items, allowed_weight, allowed_volume); err != nil {
+		fmt.Printf("Can't use two-dimensional dynamic programming: %v\n\n", err)
+	} else {
+		fmt.Println("*** Two-dimensional dynamic programming ***")
+		run_solver(no_stats(func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return two_dimensional_dynamic_programming(items, allowed_weight, allowed_volume)
+		}), volume_items, allowed_weight, within_volume(allowed_volume))
+	}
+
+	// Multiple knapsacks: put each item in at most one knapsack.
+	fmt.Println("*** Multiple knapsacks ***")
+	fmt.Printf("Capacities: %v\n", knapsack_capacities)
+	fmt.Println()
+
+	fmt.Println("*** Multiple-knapsack first fit ***")
+	run_multiple_knapsack(first_fit, items, knapsack_capacities)
+
+	fmt.Println("*** Multiple-knapsack branch and bound ***")
+	run_multiple_knapsack(multiple_knapsack_branch_and_bound, items, knapsack_capacities)
+
+	// Exact weight: the selection must weigh exactly the allowed weight.
+	if num_items > max_branch_and_bound_items {
+		print_too_many_items("exact-weight branch and bound", "max_branch_and_bound_items", max_branch_and_bound_items, num_items)
+	} else {
+		fmt.Println("*** Exact-weight branch and bound ***")
+		run_constrained(exact_weight_branch_and_bound, items, allowed_weight, fmt.Sprintf("weighs exactly %d", allowed_weight), weighs_exactly(allowed_weight))
+	}
+
+	fmt.Println("*** Exact-weight dynamic programming ***")
+	run_constrained(exact_weight_dynamic_programming, items, allowed_weight, fmt.Sprintf("weighs exactly %d", allowed_weight), weighs_exactly(allowed_weight))
+
+	// Cardinality: select at most max_items items.
+	fmt.Printf("*** Cardinality branch and bound (at most %d items) ***\n", max_items)
+	run_solver(func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+		solution, total_value, function_calls := cardinality_branch_and_bound(items, allowed_weight, max_items)
+		details := []string{fmt.Sprintf("Items used: %d", count_selected(solution))}
+		return solution, total_value, function_calls, solver_stats{details: details}
+	}, items, allowed_weight, at_most_items(max_items))
+
+	fmt.Printf("*** Cardinality dynamic programming (at most %d items) ***\n", max_items)
+	run_solver(func(items []Item, allowed_weight int) ([]Item, int, int, solver_stats) {
+		solution, total_value, function_calls := cardinality_dynamic_programming(items, allowed_weight, max_items)
+		details := []string{fmt.Sprintf("Items used: %d", count_selected(solution))}
+		return solution, total_value, function_calls, solver_stats{details: details}
+	}, items, allowed_weight, at_most_items(max_items))
+
+	// Covering: reach half of the total value with the least weight.
+	// Here lower weights are better.
+	target_value := sum_values(items, true) / 2
+	if err := check_cover(items, target_value); err != nil {
+		fmt.Printf("Can't solve the covering problem: %v\n\n", err)
+	} else {
+		fmt.Printf("*** Covering dynamic programming (value at least %d, minimize weight) ***\n", target_value)
+		run_constrained(func(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+			return cover_dynamic_programming(items, target_value)
+		}, items, math.MaxInt, fmt.Sprintf("is worth at least %d", target_value), worth_at_least(target_value))
+	}
+
+	// Closest value: hit a value as nearly as possible, above or below.
+	fmt.Printf("*** Closest dynamic programming (value nearest %d) ***\n", closest_target)
+	run_algorithm(func(items []Item, allowed_weight int) ([]Item, int, int) {
+		return closest_dynamic_programming(items, allowed_weight, closest_target)
+	}, items, allowed_weight)
+
+	// Partition: split all the items into two groups of nearly equal value.
+	fmt.Println("*** Partition dynamic programming ***")
+	run_partition(items)
+
+	// Requirements: some items need others to be selected too.
+	requirement_items := copy_items(items)
+	make_requirements(requirement_items)
+	if err := check_requirements(requirement_items); err != nil {
+		fmt.Printf("Can't solve with requirements: %v\n\n", err)
+	} else {
+		fmt.Println("*** Requirements branch and bound ***")
+		run_algorithm(requirements_branch_and_bound, requirement_items, allowed_weight)
+	}
+
+	// Forest: an item can only be selected if its parent is.
+	tree_items := copy_items(items)
+	make_parents(tree_items)
+	if err := check_parents(tree_items); err != nil {
+		fmt.Printf("Can't solve the forest: %v\n\n", err)
+	} else {
+		fmt.Println("*** Tree branch and bound ***")
+		run_algorithm(tree_branch_and_bound, tree_items, allowed_weight)
+
+		fmt.Println("*** Tree dynamic programming ***")
+		run_algorithm(tree_dynamic_programming, tree_items, allowed_weight)
+	}
+
+	// Quadratic knapsack: some pairs of items are worth more together.
+	synergies, err := normalize_synergies(make_synergies(num_items), num_items)
+	if err != nil {
+		fmt.Printf("Can't solve with synergies: %v\n\n", err)
+	} else {
+		fmt.Printf("*** Quadratic knapsack (%d synergies) ***\n", len(synergies))
+		fmt.Println("Dynamic programming can't handle synergies")
+		fmt.Println()
+
+		if num_items > max_exhaustive_items {
+			print_too_many_items("quadratic exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
+		} else {
+			fmt.Println("*** Quadratic exhaustive search ***")
+			run_quadratic(quadratic_exhaustive_search, items, allowed_weight, synergies)
+		}
+
+		fmt.Println("*** Quadratic branch and bound ***")
+		run_quadratic(quadratic_branch_and_bound, items, allowed_weight, synergies)
+	}
+
+	// Pareto front: the best value for every weight up to the total.
+	front := pareto_front(items, sum_weights(items, true), 0, false)
+	fmt.Printf("*** Pareto front (%d points) ***\n", len(front))
+	print_front_csv(pareto_front(items, sum_weights(items, true), max_front_points, true))
+	fmt.Println()
+
+	// Robust knapsack: weights may rise up to their worst case.
+	interval_items := copy_items(items)
+	make_weight_intervals(interval_items, max_deviation)
+	if err := check_weight_intervals(interval_items); err != nil {
+		fmt.Printf("Can't solve the robust knapsack: %v\n\n", err)
+	} else {
+		// Letting every item take its worst-case weight is the worst case.
+		fmt.Println("*** Worst-case knapsack ***")
+		run_robust(interval_items, allowed_weight, len(interval_items))
+
+		fmt.Printf("*** Robust knapsack (gamma = %d) ***\n", robust_gamma)
+		run_robust(interval_items, allowed_weight, robust_gamma)
+	}
+
+	// Target value: any solution worth at least good_enough_value will do.
+	fmt.Printf("*** Target value %d ***\n", good_enough_value)
+	fmt.Println()
+	if num_items > max_exhaustive_items {
+		print_too_many_items("target exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
+	} else {
+		fmt.Println("*** Target exhaustive search ***")
+		run_target(target_exhaustive_search, items, allowed_weight, good_enough_value)
+	}
+
+	fmt.Println("*** Target branch and bound ***")
+	run_target(target_branch_and_bound, items, allowed_weight, good_enough_value)
+
+	fmt.Println("*** Target dynamic programming ***")
+	run_target(target_dynamic_programming, items, allowed_weight, good_enough_value)
+
+	// Categories: each category has its own weight limit.
+	category_items := copy_items(items)
+	make_categories(category_items, category_names)
+	fmt.Printf("*** Category limits %s ***\n", format_limits(category_limits))
+	fmt.Println()
+	if num_items > max_exhaustive_items {
+		print_too_many_items("category exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
+	} else {
+		fmt.Println("*** Category exhaustive search ***")
+		run_categories(category_exhaustive_search, category_items, allowed_weight, category_limits)
+	}
+
+	fmt.Println("*** Category branch and bound ***")
+	run_categories(category_branch_and_bound, category_items, allowed_weight, category_limits)
+
+	if err := check_category_dynamic_programming(category_items, category_limits); err != nil {
+		fmt.Printf("Can't use category dynamic programming: %v\n\n", err)
+	} else {
+		fmt.Println("*** Category dynamic programming ***")
+		run_categories(category_dynamic_programming, category_items, allowed_weight, category_limits)
+	}
+
+	// With a single limit, dynamic programming works.
+	food_limit := map[string]int{"food": category_limits["food"]}
+	fmt.Printf("*** Category limits %s ***\n", format_limits(food_limit))
+	fmt.Println()
+	fmt.Println("*** Category branch and bound ***")
+	run_categories(category_branch_and_bound, category_items, allowed_weight, food_limit)
+
+	fmt.Println("*** Category dynamic programming ***")
+	run_categories(category_dynamic_programming, category_items, allowed_weight, food_limit)
+
+	// Setup costs: a category's first item costs extra weight and value.
+	if err := check_setups(category_setups); err != nil {
+		fmt.Printf("Can't solve with setup costs: %v\n\n", err)
+	} else {
+		fmt.Printf("*** Setup costs %s ***\n", format_setups(category_setups))
+		fmt.Println()
+		if num_items > max_exhaustive_items {
+			print_too_many_items("setup exhaustive search", "max_exhaustive_items", max_exhaustive_items, num_items)
+		} else {
+			fmt.Println("*** Setup exhaustive search ***")
+			run_setups(setup_exhaustive_search, category_items, allowed_weight, category_setups)
+		}
+
+		fmt.Println("*** Setup branch and bound ***")
+		run_setups(setup_branch_and_bound, category_items, allowed_weight, category_setups)
+	}
+
+	if verification_failed {
+		fmt.Println("*** Some solutions failed verification ***")
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,2489 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// Make items with the given values and weights.
+func items_of(values, weights []int) []Item {
+	items := make([]Item, len(values))
+	for i := range items {
+		items[i] = Item{id: i, blocked_by: -1, value: values[i], weight: weights[i], quantity: 1,
+			knapsack: -1, parent: -1, high_weight: weights[i]}
+	}
+	return items
+}
+
+// Make num_items random items from the given seed, with values 1 to 10
+// and weights 4 to 10 like the demo.
+func random_items(seed int64, num_items int) []Item {
+	random := rand.New(rand.NewSource(seed))
+	values := make([]int, num_items)
+	weights := make([]int, num_items)
+	for i := range values {
+		values[i] = random.Intn(10) + 1
+		weights[i] = random.Intn(7) + 4
+	}
+	return items_of(values, weights)
+}
+
+// With values 5, 4, 3, 1, weights 4, 3, 2, 1 and capacity 5, Dantzig's
+// bound at the root is 7. Taking item 0 leads through depths 1 to 3 to
+// the leaves 6 and 5. Skipping it, taking item 1 and item 2 reaches the
+// leaf 7 through depths 1 to 3. The root bound then prunes the nodes
+// that skip item 2 and item 1 on the way back, at depths 3 and 2.
+func TestBranchAndBoundDepthCounts(t *testing.T) {
+	items := items_of([]int{5, 4, 3, 1}, []int{4, 3, 2, 1})
+	_, value, calls, stats := branch_and_bound(items, 5)
+	if value != 7 {
+		t.Fatalf("value = %d, want 7", value)
+	}
+	want := &depth_counts{
+		visited: []int{1, 2, 3, 3, 0},
+		pruned:  []int{0, 0, 1, 1, 0},
+		leaves:  []int{0, 0, 0, 0, 3},
+	}
+	if !reflect.DeepEqual(stats.depths, want) {
+		t.Errorf("depths = %+v, want %+v", *stats.depths, *want)
+	}
+	if calls != 12 {
+		t.Errorf("calls = %d, want 12", calls)
+	}
+}
+
+// Run f and return what it printed to stdout.
+func capture_stdout(t *testing.T, f func()) string {
+	t.Helper()
+	return capture_output(t, &os.Stdout, f)
+}
+
+// Run f and return what it printed to stderr.
+func capture_stderr(t *testing.T, f func()) string {
+	t.Helper()
+	return capture_output(t, &os.Stderr, f)
+}
+
+// Run f with *stream sent to a temporary file, and return what it
+// wrote there.
+func capture_output(t *testing.T, stream **os.File, f func()) string {
+	t.Helper()
+	output, err := os.CreateTemp(t.TempDir(), "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Close()
+	saved := *stream
+	*stream = output
+	func() {
+		defer func() { *stream = saved }()
+		f()
+	}()
+	text, err := os.ReadFile(output.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(text)
+}
+
+// Check that a heuristic's solution has one entry per item, fits, is
+// worth the value it claims, and is worth no more than the optimum.
+func check_heuristic(t *testing.T, name string, items, solution []Item, value, allowed_weight int) {
+	t.Helper()
+	if len(solution) != len(items) {
+		t.Errorf("%s: the solution has %d items, want %d", name, len(solution), len(items))
+		return
+	}
+	if weight := sum_weights(solution, false); weight > allowed_weight {
+		t.Errorf("%s: the solution weighs %d, more than %d", name, weight, allowed_weight)
+	}
+	if worth := sum_values(solution, false); worth != value {
+		t.Errorf("%s: the solution is worth %d, but the heuristic claimed %d", name, worth, value)
+	}
+	if _, optimum, _ := dynamic_programming(items, allowed_weight); value > optimum {
+		t.Errorf("%s: value %d is more than the optimum %d", name, value, optimum)
+	}
+}
+
+// Each restart draws its starting point after the earlier ones, so with
+// the same seed more restarts only add local optima to choose from and
+// can never give a worse solution.
+func TestHillClimbingRestarts(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		items := random_items(seed, 20)
+		allowed_weight := sum_weights(items, true) / 2
+		previous := 0
+		for restarts := 1; restarts <= 20; restarts++ {
+			name := fmt.Sprintf("seed %d, %d restarts", seed, restarts)
+			solution, value, _, local_values := do_hill_climbing(copy_items(items), allowed_weight, restarts, rand.New(rand.NewSource(seed)))
+			check_heuristic(t, name, items, solution, value, allowed_weight)
+			if len(local_values) != restarts {
+				t.Errorf("%s: %d local optima", name, len(local_values))
+			}
+			if value < previous {
+				t.Errorf("%s: value %d, but fewer restarts found %d", name, value, previous)
+			}
+			previous = value
+		}
+	}
+}
+
+// Beam search must return a solution that fits at any width. With no
+// limit on the width, it keeps every state and so finds the optimum.
+func TestBeamSearch(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		items := random_items(seed, 14)
+		allowed_weight := sum_weights(items, true) / 2
+		for _, width := range []int{1, 2, 10} {
+			solution, value, _, _ := do_beam_search(copy_items(items), allowed_weight, width)
+			check_heuristic(t, fmt.Sprintf("seed %d, width %d", seed, width), items, solution, value, allowed_weight)
+		}
+		_, optimum, _ := dynamic_programming(items, allowed_weight)
+		if _, value, _, discarded := do_beam_search(copy_items(items), allowed_weight, 0); value != optimum || discarded != 0 {
+			t.Errorf("seed %d, unlimited width: value %d with %d states discarded, want the optimum %d and none",
+				seed, value, discarded, optimum)
+		}
+	}
+}
+
+// GRASP must return a solution that fits, from one of its iterations.
+// With alpha = 0 the construction is plain greedy, so the seed can't
+// change the result.
+func TestGrasp(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		items := random_items(seed, 20)
+		allowed_weight := sum_weights(items, true) / 2
+		name := fmt.Sprintf("seed %d", seed)
+		solution, value, _, best_iteration, mean_constructed := do_grasp(copy_items(items), allowed_weight, 0.3, 10, rand.New(rand.NewSource(seed)))
+		check_heuristic(t, name, items, solution, value, allowed_weight)
+		if best_iteration < 0 || best_iteration >= 10 {
+			t.Errorf("%s: best iteration %d of 10", name, best_iteration)
+		}
+		if mean_constructed > float64(value) {
+			t.Errorf("%s: mean constructed value %.2f is more than the best improved value %d", name, mean_constructed, value)
+		}
+
+		_, greedy, _, _, _ := do_grasp(copy_items(items), allowed_weight, 0, 5, rand.New(rand.NewSource(seed)))
+		if _, other, _, _, _ := do_grasp(copy_items(items), allowed_weight, 0, 5, rand.New(rand.NewSource(seed+1000))); other != greedy {
+			t.Errorf("%s: alpha 0 found %d and %d with different seeds", name, greedy, other)
+		}
+	}
+}
+
+// Randomized rounding must return a solution that fits, worth at least
+// the mean of its trials. When every item fits, the LP relaxation takes
+// them all, and so does every trial.
+func TestRandomizedRounding(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		items := random_items(seed, 20)
+		allowed_weight := sum_weights(items, true) / 2
+		name := fmt.Sprintf("seed %d", seed)
+		solution, value, mean_value := do_randomized_rounding(copy_items(items), allowed_weight, 20, rand.New(rand.NewSource(seed)))
+		check_heuristic(t, name, items, solution, value, allowed_weight)
+		if mean_value > float64(value) {
+			t.Errorf("%s: mean trial value %.2f is more than the best value %d", name, mean_value, value)
+		}
+
+		total_weight := sum_weights(items, true)
+		if _, value, _ := do_randomized_rounding(copy_items(items), total_weight, 5, rand.New(rand.NewSource(seed))); value != sum_values(items, true) {
+			t.Errorf("%s: value %d with room for every item, want %d", name, value, sum_values(items, true))
+		}
+	}
+}
+
+// The gap is to the optimum when we know it, is at most the gap to the
+// upper bound when we only know that, and unknown otherwise.
+func TestPrintGap(t *testing.T) {
+	cases := []struct {
+		value, optimum, upper_bound int
+		want                        string
+	}{
+		{90, 100, -1, "Gap: 10 (10.00%)\n"},
+		{100, 100, -1, "Gap: 0 (0.00%)\n"},
+		{0, 0, -1, "Gap: 0 (0.00%)\n"},
+		{90, -1, 120, "Gap: <= 30 (<= 25.00% from optimal)\n"},
+		{90, -1, -1, "Gap: unknown\n"},
+	}
+	for _, c := range cases {
+		if got := capture_stdout(t, func() { print_gap(c.value, c.optimum, c.upper_bound) }); got != c.want {
+			t.Errorf("print_gap(%d, %d, %d) printed %q, want %q", c.value, c.optimum, c.upper_bound, got, c.want)
+		}
+	}
+}
+
+// With time to finish, the anytime search must prove its solution is
+// the optimum.
+func TestAutoExact(t *testing.T) {
+	for seed := int64(1); seed <= 30; seed++ {
+		items := random_items(seed, int(seed%20)+1)
+		allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+		name := fmt.Sprintf("seed %d", seed)
+		solution, value, _, stats := auto_exact(items, allowed_weight)
+		check_heuristic(t, name, items, solution, value, allowed_weight)
+		_, optimum, _ := dynamic_programming(items, allowed_weight)
+		if stats.stop == time_limit_expired || value != optimum {
+			t.Errorf("%s: value %d, stop %v, want the proven optimum %d", name, value, stats.stop, optimum)
+		}
+	}
+}
+
+// Large neighborhood search starts from the greedy solution, and its
+// trajectory must list each improvement in order, ending at the value
+// it returns.
+func TestLargeNeighborhoodSearch(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		items := random_items(seed, 20)
+		allowed_weight := sum_weights(items, true) / 2
+		name := fmt.Sprintf("seed %d", seed)
+		solution, value, improvements, trajectory := do_large_neighborhood_search(copy_items(items), allowed_weight, 30, 0.3, rand.New(rand.NewSource(seed)))
+		check_heuristic(t, name, items, solution, value, allowed_weight)
+
+		greedy := copy_items(items)
+		greedy_selection(greedy, allowed_weight)
+		if trajectory[0] != sum_values(greedy, false) {
+			t.Errorf("%s: the trajectory starts at %d, greedy finds %d", name, trajectory[0], sum_values(greedy, false))
+		}
+		if len(trajectory) != improvements+1 || trajectory[len(trajectory)-1] != value {
+			t.Errorf("%s: trajectory %v after %d improvements, want it to end at %d", name, trajectory, improvements, value)
+		}
+		for k := 1; k < len(trajectory); k++ {
+			if trajectory[k] <= trajectory[k-1] {
+				t.Errorf("%s: trajectory %v doesn't always improve", name, trajectory)
+				break
+			}
+		}
+	}
+}
+
+// Make num_items items, each worth its weight plus bonus, with the
+// capacity at half the total weight. With the weights between 1000 and
+// 1999 every item has nearly the same density, which makes the bounds
+// weak and the tree searches long.
+func correlated_items(seed int64, num_items, bonus int) ([]Item, int) {
+	random := rand.New(rand.NewSource(seed))
+	values := make([]int, num_items)
+	weights := make([]int, num_items)
+	for i := range values {
+		weights[i] = random.Intn(1000) + 1000
+		values[i] = weights[i] + bonus
+	}
+	items := items_of(values, weights)
+	return items, sum_weights(items, true) / 2
+}
+
+// Return a fake clock that starts at the Unix epoch and moves on a
+// millisecond each time it is read.
+func fake_clock() func() time.Time {
+	clock := time.Unix(0, 0)
+	return func() time.Time {
+		clock = clock.Add(time.Millisecond)
+		return clock
+	}
+}
+
+// The fake clock makes the anytime search's trajectory the same on
+// every run. The search reads it once at the start, once for each new
+// incumbent and once every 1024 nodes, so this instance improves the
+// greedy start six times and finishes after about 72,800 nodes. A
+// budget that runs out part way keeps the start of the trajectory and
+// falls back to the root bound as the upper bound.
+func TestAutoExactTrajectory(t *testing.T) {
+	items, allowed_weight := correlated_items(3, 30, 100)
+	root_bound := sorted_bound(items, density_order(items), 0, allowed_weight)
+	_, optimum, _ := dynamic_programming(items, allowed_weight)
+
+	_, value, _, proven, upper_bound, trajectory, _ := do_auto_exact(copy_items(items), allowed_weight, root_bound, time.Hour, fake_clock())
+	if !proven || value != optimum || upper_bound != optimum {
+		t.Fatalf("value %d, proven %v, upper bound %d, want the proven optimum %d", value, proven, upper_bound, optimum)
+	}
+	if len(trajectory) != 7 || trajectory[len(trajectory)-1].value != value {
+		t.Fatalf("trajectory %v, want 7 points ending at %d", trajectory, value)
+	}
+	for k := 1; k < len(trajectory); k++ {
+		if trajectory[k].value <= trajectory[k-1].value || trajectory[k].elapsed <= trajectory[k-1].elapsed {
+			t.Fatalf("trajectory %v doesn't improve at every point", trajectory)
+		}
+	}
+	if again := fake_trajectory(items, allowed_weight, root_bound, time.Hour); !reflect.DeepEqual(again, trajectory) {
+		t.Errorf("the second run's trajectory %v differs from the first's %v", again, trajectory)
+	}
+
+	budget := trajectory[3].elapsed
+	_, value, _, proven, upper_bound, cut, _ := do_auto_exact(copy_items(items), allowed_weight, root_bound, budget, fake_clock())
+	if proven || upper_bound != root_bound || value >= optimum {
+		t.Errorf("with a budget of %v: value %d, proven %v, upper bound %d, want an unproven value below %d and the root bound %d",
+			budget, value, proven, upper_bound, optimum, root_bound)
+	}
+	if len(cut) == 0 || len(cut) >= len(trajectory) || !reflect.DeepEqual(cut, trajectory[:len(cut)]) {
+		t.Errorf("with a budget of %v the trajectory is %v, want the start of %v", budget, cut, trajectory)
+	}
+}
+
+// Return the anytime search's trajectory on a fresh fake clock.
+func fake_trajectory(items []Item, allowed_weight, root_bound int, budget time.Duration) []trajectory_point {
+	_, _, _, _, _, trajectory, _ := do_auto_exact(copy_items(items), allowed_weight, root_bound, budget, fake_clock())
+	return trajectory
+}
+
+// When each item is worth its weight, Dantzig's bound at the root is
+// the capacity, and some subset nearly always fills it. Without the
+// root-bound stop, the tree searches would visit up to 2^41 nodes of
+// these 40 items. With it, they stop once they find that subset.
+func TestRootBoundStop(t *testing.T) {
+	const max_calls = 100_000
+	items, allowed_weight := correlated_items(1, 40, 0)
+	for i := range items {
+		items[i].volume = items[i].weight
+	}
+
+	_, value, calls, stats := branch_and_bound(items, allowed_weight)
+	if value != allowed_weight || stats.stop != met_root_bound || calls > max_calls {
+		t.Errorf("branch and bound: value %d, stop %v after %d calls, want %d, met_root_bound, at most %d calls",
+			value, stats.stop, calls, allowed_weight, max_calls)
+	}
+	for _, alg := range []named_solver{
+		{"Rod's technique", rods_technique},
+		{"Rod's sorted technique", rods_technique_sorted},
+	} {
+		_, value, calls, stats := alg.alg(items, allowed_weight)
+		if value != allowed_weight || stats.stop != met_root_bound || calls > max_calls {
+			t.Errorf("%s: value %d, stop %v after %d calls, want %d, met_root_bound, at most %d calls",
+				alg.name, value, stats.stop, calls, allowed_weight, max_calls)
+		}
+	}
+
+	// The variants don't report a stop reason, so their call counts
+	// show the stop.
+	variants := []struct {
+		name  string
+		solve func() ([]Item, int, int)
+	}{
+		{"bounded", func() ([]Item, int, int) { return bounded_branch_and_bound(items, allowed_weight) }},
+		{"unbounded", func() ([]Item, int, int) { return unbounded_branch_and_bound(items, allowed_weight) }},
+		{"two-dimensional", func() ([]Item, int, int) {
+			return two_dimensional_branch_and_bound(items, allowed_weight, allowed_weight)
+		}},
+		{"multiple knapsack", func() ([]Item, int, int) {
+			return multiple_knapsack_branch_and_bound(items, []int{allowed_weight})
+		}},
+		{"exact weight", func() ([]Item, int, int) {
+			solution, value, calls, _ := exact_weight_branch_and_bound(items, allowed_weight)
+			return solution, value, calls
+		}},
+		{"cardinality", func() ([]Item, int, int) {
+			return cardinality_branch_and_bound(items, allowed_weight, len(items))
+		}},
+		{"requirements", func() ([]Item, int, int) { return requirements_branch_and_bound(items, allowed_weight) }},
+		{"quadratic", func() ([]Item, int, int) { return quadratic_branch_and_bound(items, allowed_weight, nil) }},
+		{"target", func() ([]Item, int, int) {
+			solution, value, calls, _ := target_branch_and_bound(items, allowed_weight, allowed_weight)
+			return solution, value, calls
+		}},
+		{"category", func() ([]Item, int, int) { return category_branch_and_bound(items, allowed_weight, nil) }},
+		{"setup", func() ([]Item, int, int) { return setup_branch_and_bound(items, allowed_weight, nil) }},
+	}
+	for _, v := range variants {
+		_, value, calls := v.solve()
+		if value != allowed_weight || calls > max_calls {
+			t.Errorf("%s branch and bound: value %d after %d calls, want %d in at most %d calls",
+				v.name, value, calls, allowed_weight, max_calls)
+		}
+	}
+}
+
+// Each case breaks one constraint the verifier must catch.
+func TestVerifySolutionConstraints(t *testing.T) {
+	selected := func(items []Item, ids ...int) []Item {
+		solution := empty_solution(items)
+		for _, i := range ids {
+			solution[i].is_selected = true
+		}
+		return solution
+	}
+	items := items_of([]int{3, 4, 5}, []int{1, 2, 3})
+	requirement_items := copy_items(items)
+	requirement_items[0].requires = []int{2}
+	tree_items := copy_items(items)
+	tree_items[1].parent = 2
+	volume_items := copy_items(items)
+	volume_items[0].volume = 4
+	quantity_items := copy_items(items)
+	quantity_items[0].num_selected = 2
+
+	cases := []struct {
+		name     string
+		items    []Item
+		solution []Item
+		value    int
+		check    constraint_check
+	}{
+		{"requirement", requirement_items, selected(requirement_items, 0), 3, nil},
+		{"parent", tree_items, selected(tree_items, 1), 4, nil},
+		{"volume", volume_items, selected(volume_items, 0), 3, within_volume(3)},
+		{"quantity", quantity_items, selected(quantity_items, 0), 6, within_quantities},
+		{"cardinality", items, selected(items, 0, 1), 7, at_most_items(1)},
+	}
+	for _, c := range cases {
+		if err := verify_solution(c.items, c.solution, c.value, 10, c.check); err == nil {
+			t.Errorf("%s: verify_solution accepted a solution that breaks the constraint", c.name)
+		}
+		if err := verify_solution(c.items, empty_solution(c.items), 0, 10, c.check); err != nil {
+			t.Errorf("%s: verify_solution rejected the empty solution: %v", c.name, err)
+		}
+	}
+}
+
+// Each case fails verification in one way, and the error must say which.
+func TestVerifySolutionFailures(t *testing.T) {
+	items := items_of([]int{3, 4, 5}, []int{1, 2, 3})
+	requirement_items := copy_items(items)
+	requirement_items[0].requires = []int{2}
+	tree_items := copy_items(items)
+	tree_items[1].parent = 2
+	select_items := func(items []Item, ids ...int) []Item {
+		solution := empty_solution(items)
+		for _, i := range ids {
+			solution[i].is_selected = true
+		}
+		return solution
+	}
+
+	cases := []struct {
+		name           string
+		items          []Item
+		solution       []Item
+		value          int
+		allowed_weight int
+		want           string
+	}{
+		{"nil solution", items, nil, 0, 10, "no solution"},
+		{"wrong length", items, select_items(items[:2], 0), 3, 10, "has 2 items"},
+		{"too heavy", items, select_items(items, 1, 2), 9, 4, "weighs 5"},
+		{"too heavy for a negative capacity", items, select_items(items, 0), 3, -1, "weighs 1"},
+		{"value mismatch", items, select_items(items, 0, 1), 8, 10, "worth 7"},
+		{"broken requirement", requirement_items, select_items(requirement_items, 0), 3, 10, "requires"},
+		{"broken parent", tree_items, select_items(tree_items, 1), 4, 10, "parent"},
+	}
+	for _, c := range cases {
+		err := verify_solution(c.items, c.solution, c.value, c.allowed_weight, nil)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: got error %v, want one containing %q", c.name, err, c.want)
+		}
+	}
+
+	// The empty selection is the only solution at a negative capacity.
+	for _, allowed_weight := range []int{0, -1, -10} {
+		if err := verify_solution(items, empty_solution(items), 0, allowed_weight, nil); err != nil {
+			t.Errorf("capacity %d: verify_solution rejected the empty solution: %v", allowed_weight, err)
+		}
+	}
+}
+
+// Count the nodes of the tree estimate_tree_size probes: branch and
+// bound with the incumbent fixed at estimate_incumbent.
+func count_fixed_incumbent_tree(items []Item, allowed_weight, depth, incumbent, current_value, current_weight, remaing_value int) int {
+	if depth == len(items) || current_value+remaing_value <= incumbent {
+		return 1
+	}
+	remaing_value -= items[depth].value
+	nodes := 1 + count_fixed_incumbent_tree(items, allowed_weight, depth+1, incumbent, current_value, current_weight, remaing_value)
+	if current_weight+items[depth].weight <= allowed_weight {
+		nodes += count_fixed_incumbent_tree(items, allowed_weight, depth+1, incumbent,
+			current_value+items[depth].value, current_weight+items[depth].weight, remaing_value)
+	}
+	return nodes
+}
+
+// With many probes the estimate must come close to the exact size of
+// the tree it estimates, and within a factor of five of the calls
+// branch_and_bound makes.
+func TestEstimateTreeSize(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		for _, num_items := range []int{14, 20} {
+			items := random_items(seed, num_items)
+			allowed_weight := sum_weights(items, true) / 2
+			incumbent := estimate_incumbent(items, allowed_weight)
+			exact := count_fixed_incumbent_tree(items, allowed_weight, 0, incumbent, 0, 0, sum_values(items, true))
+
+			name := fmt.Sprintf("seed %d, %d items", seed, num_items)
+			mean, std_err := estimate_tree_size(items, allowed_weight, 100000, rand.New(rand.NewSource(seed)))
+			if math.Abs(mean-float64(exact)) > 0.05*float64(exact) {
+				t.Errorf("%s: estimate %.1f ± %.1f, exact tree size %d", name, mean, std_err, exact)
+			}
+			if _, _, calls, _ := branch_and_bound(items, allowed_weight); mean > 5*float64(calls) || 5*mean < float64(calls) {
+				t.Errorf("%s: estimate %.1f, but branch_and_bound made %d calls", name, mean, calls)
+			}
+		}
+	}
+}
+
+func TestSummarizeSolution(t *testing.T) {
+	// Items 0 (10, 2) and 1 (9, 3) are selected, so the slack is 2 and
+	// item 1 is the marginal item with density 3. Item 2 is dominated by
+	// item 0, item 3 doesn't fit the slack, item 4 fits but has density 2,
+	// and item 5 fits with density 4.
+	items := items_of([]int{10, 9, 5, 20, 2, 4}, []int{2, 3, 3, 20, 1, 1})
+	items[0].is_selected = true
+	items[1].is_selected = true
+	want := solution_summary{left_out: 4, dominated: 1, too_heavy: 1, close_calls: 1, missed: 1, slack: 2, marginal: 1}
+	if got := summarize_solution(items, 7); got != want {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+
+	// An optimal solution can't leave out an item that fits the slack
+	// and is at least as dense as the marginal item.
+	for seed := int64(1); seed <= 5; seed++ {
+		items := random_items(seed, 20)
+		allowed_weight := sum_weights(items, true) / 2
+		solution, _, _ := dynamic_programming(items, allowed_weight)
+		summary := summarize_solution(solution, allowed_weight)
+		if summary.missed != 0 {
+			t.Errorf("seed %d: the optimal solution missed %d items", seed, summary.missed)
+		}
+		if got := summary.dominated + summary.too_heavy + summary.close_calls + summary.missed; got != summary.left_out {
+			t.Errorf("seed %d: the buckets hold %d items, but %d were left out", seed, got, summary.left_out)
+		}
+	}
+}
+
+// Return which items a solution selects.
+func selection_of(solution []Item) []bool {
+	selected := make([]bool, len(solution))
+	for i, item := range solution {
+		selected[i] = item.is_selected
+	}
+	return selected
+}
+
+// The parallel algorithms must find the same solution with any number
+// of workers, and one worker runs the serial algorithm.
+func TestParallelWorkerCounts(t *testing.T) {
+	parallel := map[string]func([]Item, int, int) ([]Item, int, int){
+		"exhaustive search": parallel_exhaustive_search,
+		"Rod's technique": func(items []Item, allowed_weight, workers int) ([]Item, int, int) {
+			solution, total_value, function_calls, _ := parallel_rods_technique(items, allowed_weight, workers)
+			return solution, total_value, function_calls
+		},
+		"dynamic programming": parallel_dynamic_programming,
+	}
+	for name, alg := range parallel {
+		for seed := int64(1); seed <= 3; seed++ {
+			items := random_items(seed, 16)
+			allowed_weight := sum_weights(items, true) / 2
+			serial, serial_value, _ := alg(items, allowed_weight, 1)
+			for _, workers := range []int{2, 3, 4, 8} {
+				solution, value, _ := alg(items, allowed_weight, workers)
+				if value != serial_value || !reflect.DeepEqual(selection_of(solution), selection_of(serial)) {
+					t.Errorf("%s, seed %d: %d workers found value %d, 1 worker %d", name, seed, workers, value, serial_value)
+				}
+			}
+		}
+	}
+}
+
+// On a table big enough for the parallel path, parallel dynamic
+// programming must find the serial solution.
+func TestParallelDynamicProgramming(t *testing.T) {
+	items := make_items(parallel_dp_items, min_value, max_value, min_weight, max_weight)
+	allowed_weight := sum_weights(items, true) / 2
+	if cells := len(items) * (allowed_weight + 1); cells < parallel_dp_min_cells {
+		t.Fatalf("the table has %d cells, too few for the parallel path", cells)
+	}
+	serial, serial_value, serial_cells := dynamic_programming(items, allowed_weight)
+	for _, workers := range []int{2, 3, 7} {
+		solution, value, cells := parallel_dynamic_programming(items, allowed_weight, workers)
+		if value != serial_value || cells != serial_cells || !reflect.DeepEqual(selection_of(solution), selection_of(serial)) {
+			t.Errorf("%d workers: value %d, %d cells, want %d, %d cells and the serial selection", workers, value, cells, serial_value, serial_cells)
+		}
+	}
+}
+
+// With an absurd capacity and values, both tables would be far too big,
+// so check_dynamic_programming_size must say so without allocating
+// either. With small values, the value table fits, and
+// dynamic_programming must use it even at math.MaxInt, where
+// allowed_weight+1 overflows.
+func TestDynamicProgrammingSize(t *testing.T) {
+	items := items_of([]int{1e12, 2e12, 3e12}, []int{1, 2, 3})
+	for _, allowed_weight := range []int{1e15, math.MaxInt} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		err := check_dynamic_programming_size(items, allowed_weight)
+		runtime.ReadMemStats(&after)
+		if err == nil {
+			t.Errorf("capacity %d: no error for tables this big", allowed_weight)
+		}
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<16 {
+			t.Errorf("capacity %d: the check allocated %d bytes", allowed_weight, allocated)
+		}
+	}
+
+	items = items_of([]int{3, 4, 5}, []int{1, 2, 3})
+	if err := check_dynamic_programming_size(items, math.MaxInt); err != nil {
+		t.Fatalf("small values: %v", err)
+	}
+	if _, value, _ := dynamic_programming(items, math.MaxInt); value != 12 {
+		t.Errorf("small values: value %d, want all 12", value)
+	}
+}
+
+// Run parallel Rod's technique with several workers on several threads,
+// so that go test -race sees them share the incumbent. Each run must
+// still find the serial solution.
+func TestParallelRodsTechniqueRace(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	for seed := int64(1); seed <= 4; seed++ {
+		items := random_items(seed, 30)
+		allowed_weight := sum_weights(items, true) / 2
+		serial, serial_value, _, _ := rods_technique_sorted(items, allowed_weight)
+		for _, workers := range []int{2, 4, 8} {
+			solution, value, _, _ := parallel_rods_technique(items, allowed_weight, workers)
+			if value != serial_value || !reflect.DeepEqual(selection_of(solution), selection_of(serial)) {
+				t.Errorf("seed %d, %d workers: value %d, want %d and the serial selection", seed, workers, value, serial_value)
+			}
+		}
+	}
+}
+
+// With several threads the workers finish in a different order on
+// every run, but the parallel algorithms must still break ties the same
+// way. Each item here has a twin, and at a third of the total weight
+// the optimum takes only one of some pair, so it isn't unique.
+func TestParallelSolversRepeat(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	num_runs := 100
+	if testing.Short() {
+		num_runs = 10
+	}
+	twins := random_items(5, 8)
+	values := make([]int, 0, 2*len(twins))
+	weights := make([]int, 0, 2*len(twins))
+	for _, item := range twins {
+		values = append(values, item.value, item.value)
+		weights = append(weights, item.weight, item.weight)
+	}
+	items := items_of(values, weights)
+	allowed_weight := sum_weights(items, true) / 3
+	big_items := make_items(parallel_dp_items, min_value, max_value, min_weight, max_weight)
+	big_weight := sum_weights(big_items, true) / 2
+
+	if n := count_optimal_selections(items, allowed_weight); n < 2 {
+		t.Fatalf("the instance has %d optimal selections, want a tie", n)
+	}
+
+	parallel := []struct {
+		name string
+		alg  func() ([]Item, int)
+	}{
+		{"exhaustive search", func() ([]Item, int) {
+			solution, value, _ := parallel_exhaustive_search(items, allowed_weight, 4)
+			return solution, value
+		}},
+		{"Rod's technique", func() ([]Item, int) {
+			solution, value, _, _ := parallel_rods_technique(items, allowed_weight, 4)
+			return solution, value
+		}},
+		{"dynamic programming", func() ([]Item, int) {
+			solution, value, _ := parallel_dynamic_programming(big_items, big_weight, 4)
+			return solution, value
+		}},
+	}
+	for _, p := range parallel {
+		first, first_value := p.alg()
+		for run := 1; run < num_runs; run++ {
+			solution, value := p.alg()
+			if value != first_value || !reflect.DeepEqual(selection_of(solution), selection_of(first)) {
+				t.Errorf("%s, run %d: found %v (%d), the first run %v (%d)", p.name, run,
+					selected_positions(solution), value, selected_positions(first), first_value)
+				break
+			}
+		}
+	}
+}
+
+// Run the solvers concurrently, so that go test -race checks that they
+// share nothing but the input. Each result must be printed as one
+// block, and the exact solvers must agree.
+func TestRunConcurrently(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	items := random_items(1, 20)
+	allowed_weight := sum_weights(items, true) / 2
+	solvers := concurrent_solvers(items, allowed_weight, 2)
+
+	var results []solver_result
+	text := capture_stdout(t, func() { results = run_concurrently(solvers, items, allowed_weight) })
+	if verification_failed {
+		t.Error("a solution failed verification")
+	}
+
+	_, optimum, _ := dynamic_programming(items, allowed_weight)
+	for k, result := range results {
+		if result.name != solvers[k].name {
+			t.Errorf("result %d is for %s, want %s", k, result.name, solvers[k].name)
+		}
+		if result.value > optimum {
+			t.Errorf("%s found value %d, more than the optimum %d", result.name, result.value, optimum)
+		}
+		if result.stats.stop != no_stop_reason && result.value != optimum {
+			t.Errorf("%s found value %d, want the optimum %d", result.name, result.value, optimum)
+		}
+	}
+
+	// Every block starts with its header and has exactly one value line.
+	blocks := strings.Split(strings.TrimSpace(text), "\n\n")
+	if len(blocks) != len(solvers) {
+		t.Fatalf("printed %d blocks, want %d", len(blocks), len(solvers))
+	}
+	for _, block := range blocks {
+		if !strings.HasPrefix(block, "*** ") || strings.Count(block, "\nValue: ") != 1 {
+			t.Errorf("interleaved block:\n%s", block)
+		}
+	}
+}
+
+// The exact solvers for the basic knapsack.
+var exact_solvers = []named_solver{
+	{"exhaustive search", no_stats(exhaustive_search)},
+	{"branch and bound", branch_and_bound},
+	{"Rod's technique", rods_technique},
+	{"Rod's sorted technique", rods_technique_sorted},
+	{"dynamic programming", no_stats(dynamic_programming)},
+}
+
+// Check that every exact solver finds a solution that checks out and
+// is worth optimum.
+func check_exact_solvers(t *testing.T, name string, items []Item, allowed_weight, optimum int) {
+	t.Helper()
+	for _, s := range exact_solvers {
+		solution, value, _, _ := s.alg(items, allowed_weight)
+		if value != optimum {
+			t.Errorf("%s: %s found value %d, want %d", name, s.name, value, optimum)
+		}
+		if err := verify_solution(items, solution, value, allowed_weight, nil); err != nil {
+			t.Errorf("%s: %s: %v", name, s.name, err)
+		}
+	}
+}
+
+// All the exact solvers must agree with exhaustive search.
+func TestExactSolversAgree(t *testing.T) {
+	num_seeds := int64(200)
+	if testing.Short() {
+		num_seeds = 20
+	}
+	for seed := int64(1); seed <= num_seeds; seed++ {
+		for num_items := 1; num_items <= 18; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			_, optimum, _ := exhaustive_search(items, allowed_weight)
+			check_exact_solvers(t, fmt.Sprintf("seed %d, %d items", seed, num_items), items, allowed_weight, optimum)
+		}
+	}
+}
+
+func TestExactSolversEdgeCases(t *testing.T) {
+	cases := []struct {
+		name           string
+		items          []Item
+		allowed_weight int
+		optimum        int
+	}{
+		{"no items", items_of(nil, nil), 10, 0},
+		{"no items, zero capacity", items_of(nil, nil), 0, 0},
+		{"one item heavier than the capacity", items_of([]int{5}, []int{11}), 10, 0},
+		{"zero capacity", items_of([]int{5, 3}, []int{1, 2}), 0, 0},
+		{"negative capacity", items_of([]int{5, 3}, []int{1, 2}), -1, 0},
+		{"identical items", items_of([]int{4, 4, 4, 4}, []int{3, 3, 3, 3}), 10, 12},
+		{"capacity above the total weight", items_of([]int{2, 7, 1}, []int{5, 4, 6}), 100, 10},
+		{"item weighs the whole capacity", items_of([]int{9, 4, 4}, []int{10, 5, 6}), 10, 9},
+	}
+	for _, c := range cases {
+		check_exact_solvers(t, c.name, c.items, c.allowed_weight, c.optimum)
+	}
+}
+
+// A solver for one capacity, with its other arguments bound.
+type capacity_solver struct {
+	name  string
+	solve func(items []Item, allowed_weight int) ([]Item, int, int)
+}
+
+// Every solver, the variants and heuristics included, with the
+// variants' other arguments set so they don't get in the way.
+func capacity_solvers() []capacity_solver {
+	solvers := []capacity_solver{}
+	for _, s := range concurrent_solvers(nil, 0, 2) {
+		solvers = append(solvers, capacity_solver{s.name, func(items []Item, allowed_weight int) ([]Item, int, int) {
+			solution, value, calls, _ := s.alg(items, allowed_weight)
+			return solution, value, calls
+		}})
+	}
+	drop_flag := func(alg func([]Item, int) ([]Item, int, int, bool)) func([]Item, int) ([]Item, int, int) {
+		return func(items []Item, allowed_weight int) ([]Item, int, int) {
+			solution, value, calls, _ := alg(items, allowed_weight)
+			return solution, value, calls
+		}
+	}
+	limits := map[string]int{"": 100}
+	setups := map[string]setup_cost{"": {1, 1}}
+	return append(solvers,
+		capacity_solver{"ordered branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return ordered_branch_and_bound(items, allowed_weight, "value")
+		}},
+		capacity_solver{"parallel dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return parallel_dynamic_programming(items, allowed_weight, 2)
+		}},
+		capacity_solver{"value dynamic programming", value_dynamic_programming},
+		capacity_solver{"bounded branch and bound", bounded_branch_and_bound},
+		capacity_solver{"bounded dynamic programming", bounded_dynamic_programming},
+		capacity_solver{"unbounded branch and bound", unbounded_branch_and_bound},
+		capacity_solver{"unbounded dynamic programming", unbounded_dynamic_programming},
+		capacity_solver{"multiple-choice dynamic programming", drop_flag(multiple_choice_dynamic_programming)},
+		capacity_solver{"two-dimensional dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return two_dimensional_dynamic_programming(items, allowed_weight, allowed_weight)
+		}},
+		capacity_solver{"two-dimensional branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return two_dimensional_branch_and_bound(items, allowed_weight, allowed_weight)
+		}},
+		capacity_solver{"first fit", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return first_fit(items, []int{allowed_weight, allowed_weight})
+		}},
+		capacity_solver{"multiple knapsack branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return multiple_knapsack_branch_and_bound(items, []int{allowed_weight, allowed_weight})
+		}},
+		capacity_solver{"exact-weight dynamic programming", drop_flag(exact_weight_dynamic_programming)},
+		capacity_solver{"exact-weight branch and bound", drop_flag(exact_weight_branch_and_bound)},
+		capacity_solver{"cardinality dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return cardinality_dynamic_programming(items, allowed_weight, 2)
+		}},
+		capacity_solver{"cardinality branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return cardinality_branch_and_bound(items, allowed_weight, 2)
+		}},
+		capacity_solver{"closest dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return closest_dynamic_programming(items, allowed_weight, 1)
+		}},
+		capacity_solver{"requirements branch and bound", requirements_branch_and_bound},
+		capacity_solver{"tree branch and bound", tree_branch_and_bound},
+		capacity_solver{"tree dynamic programming", tree_dynamic_programming},
+		capacity_solver{"quadratic exhaustive search", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return quadratic_exhaustive_search(items, allowed_weight, nil)
+		}},
+		capacity_solver{"quadratic branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return quadratic_branch_and_bound(items, allowed_weight, nil)
+		}},
+		capacity_solver{"robust knapsack", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return robust_knapsack(items, allowed_weight, 1)
+		}},
+		capacity_solver{"target exhaustive search", drop_flag(func(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+			return target_exhaustive_search(items, allowed_weight, 1)
+		})},
+		capacity_solver{"target branch and bound", drop_flag(func(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+			return target_branch_and_bound(items, allowed_weight, 1)
+		})},
+		capacity_solver{"target dynamic programming", drop_flag(func(items []Item, allowed_weight int) ([]Item, int, int, bool) {
+			return target_dynamic_programming(items, allowed_weight, 1)
+		})},
+		capacity_solver{"category exhaustive search", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return category_exhaustive_search(items, allowed_weight, limits)
+		}},
+		capacity_solver{"category branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return category_branch_and_bound(items, allowed_weight, limits)
+		}},
+		capacity_solver{"category dynamic programming", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return category_dynamic_programming(items, allowed_weight, limits)
+		}},
+		capacity_solver{"setup exhaustive search", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return setup_exhaustive_search(items, allowed_weight, setups)
+		}},
+		capacity_solver{"setup branch and bound", func(items []Item, allowed_weight int) ([]Item, int, int) {
+			return setup_branch_and_bound(items, allowed_weight, setups)
+		}},
+	)
+}
+
+// When every item is heavier than the capacity, each solver must
+// return the empty selection, worth 0, and count no negative calls or
+// cells. A negative capacity once made some of them return nil or a
+// negative cell count.
+func TestItemsHeavierThanCapacity(t *testing.T) {
+	items := items_of([]int{3, 7, 4}, []int{5, 9, 6})
+	for _, s := range capacity_solvers() {
+		for _, allowed_weight := range []int{4, 0, -1, -3} {
+			solution, value, calls := s.solve(items, allowed_weight)
+			if len(solution) != len(items) {
+				t.Errorf("%s at capacity %d: the solution has %d items, want %d", s.name, allowed_weight, len(solution), len(items))
+				continue
+			}
+			for i, item := range solution {
+				if num_copies(item) != 0 {
+					t.Errorf("%s at capacity %d: selected item %d", s.name, allowed_weight, i)
+				}
+			}
+			if value != 0 || calls < 0 {
+				t.Errorf("%s at capacity %d: value %d after %d calls, want 0 and no negative count", s.name, allowed_weight, value, calls)
+			}
+		}
+	}
+
+	// Without restarts, iterations or trials, the randomized heuristics
+	// still return the empty selection.
+	random := rand.New(rand.NewSource(1))
+	climbed, climbed_value, _, _ := do_hill_climbing(items, 20, 0, random)
+	constructed, constructed_value, _, _, _ := do_grasp(items, 20, 0.5, 0, random)
+	rounded, rounded_value, _ := do_randomized_rounding(items, 20, 0, random)
+	for name, solution := range map[string][]Item{"hill climbing": climbed, "GRASP": constructed, "randomized rounding": rounded} {
+		if len(solution) != len(items) || count_selected(solution) != 0 {
+			t.Errorf("%s without restarts: %d items with %v selected, want the empty selection", name, len(solution), selected_positions(solution))
+		}
+	}
+	if climbed_value != 0 || constructed_value != 0 || rounded_value != 0 {
+		t.Errorf("values %d, %d and %d without restarts, want 0", climbed_value, constructed_value, rounded_value)
+	}
+}
+
+// Call visit with a copy of the items for every selection of them.
+func for_each_selection(items []Item, visit func(selection []Item)) {
+	selection := copy_items(items)
+	for mask := 0; mask < 1<<len(items); mask++ {
+		for i := range selection {
+			selection[i].is_selected = mask>>i&1 == 1
+		}
+		visit(selection)
+	}
+}
+
+// Return the best value of the selections feasible accepts, or
+// math.MinInt if it accepts none.
+func brute_force(items []Item, feasible func([]Item) bool, value func([]Item) int) int {
+	best := math.MinInt
+	for_each_selection(items, func(selection []Item) {
+		if feasible(selection) {
+			best = max(best, value(selection))
+		}
+	})
+	return best
+}
+
+// Check that a solution has one entry per item, that feasible accepts
+// it, that it is worth the value the solver claimed, and that the value
+// is the optimum brute force found.
+func check_against_brute_force(t *testing.T, name string, items, solution []Item, claimed, optimum int,
+	feasible func([]Item) bool, value func([]Item) int) {
+	t.Helper()
+	if len(solution) != len(items) {
+		t.Errorf("%s: the solution has %d items, want %d", name, len(solution), len(items))
+		return
+	}
+	if !feasible(solution) {
+		t.Errorf("%s: selected %v, which is not feasible", name, selected_positions(solution))
+	}
+	if worth := value(solution); worth != claimed {
+		t.Errorf("%s: the solution is worth %d, but the solver claimed %d", name, worth, claimed)
+	}
+	if claimed != optimum {
+		t.Errorf("%s: found value %d, brute force found %d", name, claimed, optimum)
+	}
+}
+
+// Return a check that a selection weighs at most allowed_weight.
+func fits(allowed_weight int) func([]Item) bool {
+	return func(selection []Item) bool {
+		return sum_weights(selection, false) <= allowed_weight
+	}
+}
+
+// The value of a selection, copies included.
+func selected_value(selection []Item) int {
+	return sum_values(selection, false)
+}
+
+// The number of random instances for each size in the brute-force
+// tests.
+func num_brute_force_seeds() int64 {
+	if testing.Short() {
+		return 10
+	}
+	return 60
+}
+
+// Call visit with every way of taking 0 to limits[i] copies of item i.
+func for_each_count(limits []int, visit func(counts []int)) {
+	counts := make([]int, len(limits))
+	var recurse func(i int)
+	recurse = func(i int) {
+		if i == len(limits) {
+			visit(counts)
+			return
+		}
+		for counts[i] = 0; counts[i] <= limits[i]; counts[i]++ {
+			recurse(i + 1)
+		}
+	}
+	recurse(0)
+}
+
+// Return the best value of up to limits[i] copies of each item within
+// allowed_weight.
+func brute_force_counts(items []Item, limits []int, allowed_weight int) int {
+	best := 0
+	for_each_count(limits, func(counts []int) {
+		value, weight := 0, 0
+		for i, count := range counts {
+			value += count * items[i].value
+			weight += count * items[i].weight
+		}
+		if weight <= allowed_weight {
+			best = max(best, value)
+		}
+	})
+	return best
+}
+
+// Return a check that a solution takes at most limits[i] copies of item i
+// and fits.
+func within_counts(limits []int, allowed_weight int) func([]Item) bool {
+	return func(solution []Item) bool {
+		for i, item := range solution {
+			if num_copies(item) > limits[i] {
+				return false
+			}
+		}
+		return sum_weights(solution, false) <= allowed_weight
+	}
+}
+
+// The bounded solvers must agree with brute force over the copies of
+// each item. Binary splitting in bounded_dynamic_programming must also
+// agree with the direct approach, which lists every copy as its own
+// item for dynamic_programming.
+func TestBoundedKnapsackBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 5; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			limits := make([]int, num_items)
+			var copies []Item
+			for i := range items {
+				items[i].quantity = random.Intn(4) + 1
+				limits[i] = items[i].quantity
+				for range items[i].quantity {
+					copies = append(copies, items_of([]int{items[i].value}, []int{items[i].weight})...)
+				}
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d", seed, num_items, allowed_weight)
+			optimum := brute_force_counts(items, limits, allowed_weight)
+
+			solution, value, _ := bounded_branch_and_bound(items, allowed_weight)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum,
+				within_counts(limits, allowed_weight), selected_value)
+			solution, value, _ = bounded_dynamic_programming(items, allowed_weight)
+			check_against_brute_force(t, name+": binary splitting", items, solution, value, optimum,
+				within_counts(limits, allowed_weight), selected_value)
+			if _, direct, _ := dynamic_programming(copies, allowed_weight); direct != value {
+				t.Errorf("%s: binary splitting found %d, one item per copy %d", name, value, direct)
+			}
+		}
+	}
+}
+
+// The unbounded solvers must agree with brute force over every number
+// of copies that fits.
+func TestUnboundedKnapsackBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 4; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := int(seed % 31)
+			limits := make([]int, num_items)
+			for i := range items {
+				limits[i] = allowed_weight / items[i].weight
+			}
+			name := fmt.Sprintf("seed %d, %d items, capacity %d", seed, num_items, allowed_weight)
+			optimum := brute_force_counts(items, limits, allowed_weight)
+
+			solution, value, _ := unbounded_branch_and_bound(items, allowed_weight)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum,
+				within_counts(limits, allowed_weight), selected_value)
+			solution, value, _ = unbounded_dynamic_programming(items, allowed_weight)
+			check_against_brute_force(t, name+": dynamic programming", items, solution, value, optimum,
+				within_counts(limits, allowed_weight), selected_value)
+		}
+	}
+}
+
+// The multiple-choice solver must pick exactly one item from each group
+// and agree with brute force, or say no choice fits when none does.
+func TestMultipleChoiceBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			num_groups := int(seed%3) + 1
+			for i := range items {
+				items[i].group = i % num_groups
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5 / num_groups
+			name := fmt.Sprintf("seed %d, %d items in %d groups, capacity %d", seed, num_items, num_groups, allowed_weight)
+			one_per_group := func(selection []Item) bool {
+				counts := make([]int, min(num_groups, num_items))
+				for _, item := range selection {
+					if item.is_selected {
+						counts[item.group]++
+					}
+				}
+				for _, count := range counts {
+					if count != 1 {
+						return false
+					}
+				}
+				return sum_weights(selection, false) <= allowed_weight
+			}
+			optimum := brute_force(items, one_per_group, selected_value)
+
+			solution, value, _, feasible := multiple_choice_dynamic_programming(items, allowed_weight)
+			if feasible != (optimum >= 0) {
+				t.Errorf("%s: feasible = %v, but brute force found %d", name, feasible, optimum)
+				continue
+			}
+			if !feasible {
+				if value != 0 || len(selected_positions(solution)) != 0 {
+					t.Errorf("%s: no choice fits, but got %v worth %d", name, selected_positions(solution), value)
+				}
+				continue
+			}
+			check_against_brute_force(t, name, items, solution, value, optimum, one_per_group, selected_value)
+		}
+	}
+}
+
+// The two-dimensional solvers must respect both limits and agree with
+// brute force.
+func TestTwoDimensionalBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			for i := range items {
+				items[i].volume = random.Intn(10) + 1
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			allowed_volume := sum_volumes(items, true) * int(seed%3+1) / 4
+			name := fmt.Sprintf("seed %d, %d items, capacity %d, volume %d", seed, num_items, allowed_weight, allowed_volume)
+			feasible := func(selection []Item) bool {
+				return sum_weights(selection, false) <= allowed_weight && sum_volumes(selection, false) <= allowed_volume
+			}
+			optimum := brute_force(items, feasible, selected_value)
+
+			solution, value, _ := two_dimensional_dynamic_programming(items, allowed_weight, allowed_volume)
+			check_against_brute_force(t, name+": dynamic programming", items, solution, value, optimum, feasible, selected_value)
+			solution, value, _ = two_dimensional_branch_and_bound(items, allowed_weight, allowed_volume)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, feasible, selected_value)
+		}
+	}
+}
+
+// Branch and bound must find the best assignment to the knapsacks that
+// brute force finds. First fit must assign items that fit, worth no more.
+func TestMultipleKnapsackBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 6; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			capacities := []int{random.Intn(20), random.Intn(20) - 2}
+			name := fmt.Sprintf("seed %d, %d items, capacities %v", seed, num_items, capacities)
+			assigned := func(solution []Item) bool {
+				loads := make([]int, len(capacities))
+				for _, item := range solution {
+					if !item.is_selected {
+						continue
+					}
+					if item.knapsack < 0 || item.knapsack >= len(capacities) {
+						return false
+					}
+					loads[item.knapsack] += item.weight
+				}
+				// An empty knapsack fits even a negative capacity.
+				for k, load := range loads {
+					if load > 0 && load > capacities[k] {
+						return false
+					}
+				}
+				return true
+			}
+
+			// Each item goes in one of the knapsacks or stays out.
+			limits := make([]int, num_items)
+			for i := range limits {
+				limits[i] = len(capacities)
+			}
+			optimum := 0
+			for_each_count(limits, func(choices []int) {
+				selection := copy_items(items)
+				for i, choice := range choices {
+					selection[i].is_selected = choice < len(capacities)
+					selection[i].knapsack = choice
+				}
+				if assigned(selection) {
+					optimum = max(optimum, selected_value(selection))
+				}
+			})
+
+			solution, value, _ := multiple_knapsack_branch_and_bound(items, capacities)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, assigned, selected_value)
+			// First fit is a heuristic, so it only has to stay at or
+			// below the optimum.
+			solution, value, _ = first_fit(items, capacities)
+			check_against_brute_force(t, name+": first fit", items, solution, value, min(value, optimum), assigned, selected_value)
+		}
+	}
+}
+
+// The exact-weight solvers must find the best selection of exactly the
+// capacity's weight, and say so when there is none.
+func TestExactWeightBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, weight %d", seed, num_items, allowed_weight)
+			exact := func(selection []Item) bool {
+				return sum_weights(selection, false) == allowed_weight
+			}
+			optimum := brute_force(items, exact, selected_value)
+
+			for _, s := range []struct {
+				name string
+				alg  func([]Item, int) ([]Item, int, int, bool)
+			}{
+				{"dynamic programming", exact_weight_dynamic_programming},
+				{"branch and bound", exact_weight_branch_and_bound},
+			} {
+				solution, value, _, reachable := s.alg(items, allowed_weight)
+				if reachable != (optimum >= 0) {
+					t.Errorf("%s: %s: reachable = %v, but brute force found %d", name, s.name, reachable, optimum)
+					continue
+				}
+				if reachable {
+					check_against_brute_force(t, name+": "+s.name, items, solution, value, optimum, exact, selected_value)
+				} else if value != 0 || len(selected_positions(solution)) != 0 {
+					t.Errorf("%s: %s: no selection has the weight, but got %v worth %d", name, s.name, selected_positions(solution), value)
+				}
+			}
+		}
+	}
+}
+
+// The cardinality solvers must select at most max_items items and agree
+// with brute force.
+func TestCardinalityBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			for max_items := 0; max_items <= num_items; max_items++ {
+				name := fmt.Sprintf("seed %d, %d items, capacity %d, at most %d", seed, num_items, allowed_weight, max_items)
+				feasible := func(selection []Item) bool {
+					return len(selected_positions(selection)) <= max_items && sum_weights(selection, false) <= allowed_weight
+				}
+				optimum := brute_force(items, feasible, selected_value)
+
+				solution, value, _ := cardinality_dynamic_programming(items, allowed_weight, max_items)
+				check_against_brute_force(t, name+": dynamic programming", items, solution, value, optimum, feasible, selected_value)
+				solution, value, _ = cardinality_branch_and_bound(items, allowed_weight, max_items)
+				check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, feasible, selected_value)
+			}
+		}
+	}
+}
+
+// The covering solver must find a selection worth at least the target
+// that is as light as the lightest one brute force finds.
+func TestCoverBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			target_value := sum_values(items, true)*int(seed%5+1)/5 + int(seed%3) - 1
+			name := fmt.Sprintf("seed %d, %d items, target %d", seed, num_items, target_value)
+			reaches := func(selection []Item) bool {
+				return selected_value(selection) >= target_value
+			}
+			// The lightest selection is the best when weight counts against it.
+			lightest := brute_force(items, reaches, func(selection []Item) int {
+				return -sum_weights(selection, false)
+			})
+
+			solution, value, _, reached := cover_dynamic_programming(items, target_value)
+			if reached != (lightest != math.MinInt) {
+				t.Errorf("%s: reached = %v, want %v", name, reached, !reached)
+				continue
+			}
+			if !reached {
+				continue
+			}
+			if len(solution) != len(items) || selected_value(solution) != value || value < target_value {
+				t.Errorf("%s: selected %v worth %d, claimed %d", name, selected_positions(solution), selected_value(solution), value)
+			} else if weight := sum_weights(solution, false); -weight != lightest {
+				t.Errorf("%s: the selection weighs %d, brute force found %d", name, weight, -lightest)
+			}
+		}
+	}
+}
+
+// Make item i require a random earlier item with probability 1/3, so the
+// requirements never form a cycle.
+func random_requirements(items []Item, random *rand.Rand) {
+	for i := 1; i < len(items); i++ {
+		if random.Intn(3) == 0 {
+			items[i].requires = []int{random.Intn(i)}
+		}
+	}
+}
+
+// Return a check that a selection fits and selects every item a
+// selected item requires.
+func meets_requirements(allowed_weight int) func([]Item) bool {
+	return func(selection []Item) bool {
+		for _, item := range selection {
+			if !item.is_selected {
+				continue
+			}
+			for _, r := range item.requires {
+				if !selection[r].is_selected {
+					return false
+				}
+			}
+		}
+		return sum_weights(selection, false) <= allowed_weight
+	}
+}
+
+// Branch and bound with requirements must agree with brute force.
+func TestRequirementsBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			random_requirements(items, random)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d", seed, num_items, allowed_weight)
+			optimum := brute_force(items, meets_requirements(allowed_weight), selected_value)
+
+			solution, value, _ := requirements_branch_and_bound(items, allowed_weight)
+			check_against_brute_force(t, name, items, solution, value, optimum, meets_requirements(allowed_weight), selected_value)
+		}
+	}
+}
+
+// The forest solvers must only select items whose parent is selected
+// and agree with brute force.
+func TestTreeBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			for i := range items {
+				items[i].parent = random.Intn(i+1) - 1
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d", seed, num_items, allowed_weight)
+			feasible := func(selection []Item) bool {
+				for _, item := range selection {
+					if item.is_selected && item.parent != -1 && !selection[item.parent].is_selected {
+						return false
+					}
+				}
+				return sum_weights(selection, false) <= allowed_weight
+			}
+			optimum := brute_force(items, feasible, selected_value)
+
+			solution, value, _ := tree_branch_and_bound(items, allowed_weight)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, feasible, selected_value)
+			solution, value, _ = tree_dynamic_programming(items, allowed_weight)
+			check_against_brute_force(t, name+": dynamic programming", items, solution, value, optimum, feasible, selected_value)
+		}
+	}
+}
+
+// The quadratic solvers must count each bonus whose items are both
+// selected and agree with brute force.
+func TestQuadraticBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			var synergies []synergy
+			for i := range items {
+				for j := i + 1; j < len(items); j++ {
+					if random.Intn(4) == 0 {
+						synergies = append(synergies, synergy{i, j, random.Intn(10) + 1})
+					}
+				}
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d", seed, num_items, allowed_weight)
+			with_bonuses := func(selection []Item) int {
+				value := selected_value(selection)
+				for _, s := range synergies {
+					if selection[s.i].is_selected && selection[s.j].is_selected {
+						value += s.bonus
+					}
+				}
+				return value
+			}
+			optimum := brute_force(items, fits(allowed_weight), with_bonuses)
+
+			solution, value, _ := quadratic_exhaustive_search(items, allowed_weight, synergies)
+			check_against_brute_force(t, name+": exhaustive search", items, solution, value, optimum, fits(allowed_weight), with_bonuses)
+			solution, value, _ = quadratic_branch_and_bound(items, allowed_weight, synergies)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, fits(allowed_weight), with_bonuses)
+		}
+	}
+}
+
+// The Pareto front must list, by increasing weight, each weight where
+// the best value of a selection that weighs exactly that much beats
+// every lighter selection, and rebuild a selection for each point.
+func TestParetoFrontBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			max_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, max weight %d", seed, num_items, max_weight)
+			best := make([]int, max_weight+1)
+			for w := range best {
+				best[w] = -1
+			}
+			for_each_selection(items, func(selection []Item) {
+				if weight := sum_weights(selection, false); weight <= max_weight {
+					best[weight] = max(best[weight], selected_value(selection))
+				}
+			})
+			var want []front_point
+			for w, value := range best {
+				if value >= 0 && (len(want) == 0 || value > want[len(want)-1].value) {
+					want = append(want, front_point{w, value, nil})
+				}
+			}
+
+			front := pareto_front(items, max_weight, 0, true)
+			if len(front) != len(want) {
+				t.Errorf("%s: the front has %d points, want %d", name, len(front), len(want))
+				continue
+			}
+			for k, point := range front {
+				if point.weight != want[k].weight || point.value != want[k].value {
+					t.Errorf("%s: point %d is (%d, %d), want (%d, %d)", name, k, point.weight, point.value, want[k].weight, want[k].value)
+				}
+				if sum_weights(point.items, false) != point.weight || selected_value(point.items) != point.value {
+					t.Errorf("%s: the selection for point %d weighs %d and is worth %d", name, k,
+						sum_weights(point.items, false), selected_value(point.items))
+				}
+			}
+		}
+	}
+}
+
+// The robust solver must find the best selection that fits when any
+// gamma of its items take their worst-case weight.
+func TestRobustKnapsackBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 7; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			for i := range items {
+				items[i].high_weight = items[i].weight + random.Intn(6)
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			for gamma := 0; gamma <= num_items; gamma++ {
+				name := fmt.Sprintf("seed %d, %d items, capacity %d, gamma %d", seed, num_items, allowed_weight, gamma)
+				robust := func(selection []Item) bool {
+					weight := 0
+					var deviations []int
+					for _, item := range selection {
+						if item.is_selected {
+							weight += item.weight
+							deviations = append(deviations, item.high_weight-item.weight)
+						}
+					}
+					sort.Sort(sort.Reverse(sort.IntSlice(deviations)))
+					for k := 0; k < gamma && k < len(deviations); k++ {
+						weight += deviations[k]
+					}
+					return weight <= allowed_weight
+				}
+				optimum := brute_force(items, robust, selected_value)
+
+				solution, value, _ := robust_knapsack(items, allowed_weight, gamma)
+				check_against_brute_force(t, name, items, solution, value, optimum, robust, selected_value)
+			}
+		}
+	}
+}
+
+// The target-value solvers must reach the target whenever some
+// selection that fits does. When none does, they must return the optimum.
+func TestTargetBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			optimum := brute_force(items, fits(allowed_weight), selected_value)
+			for _, target := range []int{0, optimum / 2, optimum, optimum + 1} {
+				name := fmt.Sprintf("seed %d, %d items, capacity %d, target %d", seed, num_items, allowed_weight, target)
+				for _, s := range []struct {
+					name string
+					alg  func([]Item, int, int) ([]Item, int, int, bool)
+				}{
+					{"exhaustive search", target_exhaustive_search},
+					{"branch and bound", target_branch_and_bound},
+					{"dynamic programming", target_dynamic_programming},
+				} {
+					solution, value, _, reached := s.alg(items, allowed_weight, target)
+					if reached != (optimum >= target) {
+						t.Errorf("%s: %s: reached = %v, but the optimum is %d", name, s.name, reached, optimum)
+						continue
+					}
+					// Any selection that fits and reaches the target will do.
+					want := optimum
+					if reached {
+						want = value
+						if value < target {
+							t.Errorf("%s: %s: reached the target with value %d", name, s.name, value)
+						}
+					}
+					check_against_brute_force(t, name+": "+s.name, items, solution, value, want, fits(allowed_weight), selected_value)
+				}
+			}
+		}
+	}
+}
+
+// The category solvers must keep each category within its limit and
+// agree with brute force.
+func TestCategoryBruteForce(t *testing.T) {
+	names := []string{"food", "gear", "tools"}
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			for i := range items {
+				items[i].category = names[random.Intn(len(names))]
+			}
+			// "tools" has no limit.
+			limits := map[string]int{"food": random.Intn(25), "gear": random.Intn(25)}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d, limits %v", seed, num_items, allowed_weight, limits)
+			feasible := func(selection []Item) bool {
+				weights := make(map[string]int)
+				for _, item := range selection {
+					if item.is_selected {
+						weights[item.category] += item.weight
+					}
+				}
+				for category, limit := range limits {
+					if weights[category] > limit {
+						return false
+					}
+				}
+				return sum_weights(selection, false) <= allowed_weight
+			}
+			optimum := brute_force(items, feasible, selected_value)
+
+			solvers := []struct {
+				name string
+				alg  func([]Item, int, map[string]int) ([]Item, int, int)
+			}{
+				{"exhaustive search", category_exhaustive_search},
+				{"branch and bound", category_branch_and_bound},
+				{"dynamic programming", category_dynamic_programming},
+			}
+			// Dynamic programming handles one binding limit.
+			if check_category_dynamic_programming(items, limits) != nil {
+				solvers = solvers[:2]
+			}
+			for _, s := range solvers {
+				solution, value, _ := s.alg(items, allowed_weight, limits)
+				check_against_brute_force(t, name+": "+s.name, items, solution, value, optimum, feasible, selected_value)
+			}
+		}
+	}
+}
+
+// The closest-value solver must find the selection that fits whose
+// value is nearest the target, and the lightest one among those.
+func TestClosestBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			target_value := sum_values(items, true) * int(seed%7) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d, target %d", seed, num_items, allowed_weight, target_value)
+			distance := func(selection []Item) int {
+				return max(selected_value(selection)-target_value, target_value-selected_value(selection))
+			}
+			// Nearest first, then lightest.
+			rank := func(selection []Item) int {
+				return -(distance(selection)*1000 + sum_weights(selection, false))
+			}
+			best := brute_force(items, fits(allowed_weight), rank)
+
+			solution, value, _ := closest_dynamic_programming(items, allowed_weight, target_value)
+			if len(solution) != len(items) || selected_value(solution) != value || !fits(allowed_weight)(solution) {
+				t.Errorf("%s: selected %v worth %d, claimed %d", name, selected_positions(solution), selected_value(solution), value)
+			} else if got := rank(solution); got != best {
+				t.Errorf("%s: distance %d at weight %d, brute force found distance %d at weight %d", name,
+					distance(solution), sum_weights(solution, false), -best/1000, -best%1000)
+			}
+		}
+	}
+}
+
+// The partition must split the items so the unselected group is worth
+// at least as much as the selected one, by the least difference brute
+// force finds.
+func TestPartitionBruteForce(t *testing.T) {
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 10; num_items++ {
+			items := random_items(seed*100+int64(num_items), num_items)
+			total := sum_values(items, true)
+			difference := func(selection []Item) int {
+				return total - 2*selected_value(selection)
+			}
+			least := -brute_force(items, func(selection []Item) bool { return difference(selection) >= 0 },
+				func(selection []Item) int { return -difference(selection) })
+			name := fmt.Sprintf("seed %d, %d items", seed, num_items)
+
+			solution, value, _ := partition_dynamic_programming(items)
+			if len(solution) != len(items) || difference(solution) != value || value < 0 {
+				t.Errorf("%s: selected %v with difference %d, claimed %d", name, selected_positions(solution), difference(solution), value)
+			} else if value != least {
+				t.Errorf("%s: difference %d, brute force found %d", name, value, least)
+			}
+		}
+	}
+}
+
+// The setup solvers must charge each category's setup once when any of
+// its items is selected and agree with brute force.
+func TestSetupBruteForce(t *testing.T) {
+	names := []string{"food", "gear", "tools"}
+	for seed := int64(1); seed <= num_brute_force_seeds(); seed++ {
+		for num_items := 0; num_items <= 8; num_items++ {
+			random := rand.New(rand.NewSource(seed))
+			items := random_items(seed*100+int64(num_items), num_items)
+			for i := range items {
+				items[i].category = names[random.Intn(len(names))]
+			}
+			// "tools" has no setup.
+			setups := map[string]setup_cost{
+				"food": {random.Intn(6), random.Intn(6)},
+				"gear": {random.Intn(6), random.Intn(6)},
+			}
+			allowed_weight := sum_weights(items, true) * int(seed%4+1) / 5
+			name := fmt.Sprintf("seed %d, %d items, capacity %d, setups %v", seed, num_items, allowed_weight, setups)
+			paid := func(selection []Item) (int, int) {
+				open := make(map[string]bool)
+				weight, value := 0, 0
+				for _, item := range selection {
+					if item.is_selected && !open[item.category] {
+						open[item.category] = true
+						weight += setups[item.category].weight
+						value += setups[item.category].value
+					}
+				}
+				return weight, value
+			}
+			feasible := func(selection []Item) bool {
+				setup_weight, _ := paid(selection)
+				return sum_weights(selection, false)+setup_weight <= allowed_weight
+			}
+			net_value := func(selection []Item) int {
+				_, setup_value := paid(selection)
+				return selected_value(selection) - setup_value
+			}
+			optimum := brute_force(items, feasible, net_value)
+
+			solution, value, _ := setup_exhaustive_search(items, allowed_weight, setups)
+			check_against_brute_force(t, name+": exhaustive search", items, solution, value, optimum, feasible, net_value)
+			solution, value, _ = setup_branch_and_bound(items, allowed_weight, setups)
+			check_against_brute_force(t, name+": branch and bound", items, solution, value, optimum, feasible, net_value)
+		}
+	}
+}
+
+// Return the positions of the selected items.
+func selected_positions(solution []Item) []int {
+	positions := []int{}
+	for i, item := range solution {
+		if item.is_selected {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// Calls counts the nodes a tree search visits and the cells a dynamic
+// program computes, so on small instances the counts follow by hand.
+// Exhaustive search visits every node of the full binary tree, 2^(n+1)
+// - 1 of them, at any capacity, even when it splits the tree across
+// workers. The weight-indexed tables have one cell per item and weight
+// from 0 to the capacity, times the volumes or item counts from 0 up
+// to their limits. A count limit below the number of items keeps the
+// cardinality table from falling back to the plain one.
+func TestCallCounts(t *testing.T) {
+	for num_items := 0; num_items <= 10; num_items++ {
+		items := random_items(int64(num_items), num_items)
+		for _, allowed_weight := range []int{0, sum_weights(items, true) / 2, sum_weights(items, true)} {
+			name := fmt.Sprintf("%d items, capacity %d", num_items, allowed_weight)
+			want := 1<<(num_items+1) - 1
+			if _, _, calls := exhaustive_search(items, allowed_weight); calls != want {
+				t.Errorf("%s: exhaustive search made %d calls, want %d", name, calls, want)
+			}
+			if _, _, calls := parallel_exhaustive_search(items, allowed_weight, 4); calls != want {
+				t.Errorf("%s: parallel exhaustive search made %d calls, want %d", name, calls, want)
+			}
+			if num_items == 0 {
+				continue
+			}
+
+			want = num_items * (allowed_weight + 1)
+			if _, _, cells := dynamic_programming(items, allowed_weight); cells != want {
+				t.Errorf("%s: dynamic programming computed %d cells, want %d", name, cells, want)
+			}
+			if _, _, cells, _ := exact_weight_dynamic_programming(items, allowed_weight); cells != want {
+				t.Errorf("%s: exact-weight dynamic programming computed %d cells, want %d", name, cells, want)
+			}
+			if _, _, cells := two_dimensional_dynamic_programming(items, allowed_weight, 7); cells != want*8 {
+				t.Errorf("%s: two-dimensional dynamic programming computed %d cells, want %d", name, cells, want*8)
+			}
+			max_items := num_items / 2
+			if _, _, cells := cardinality_dynamic_programming(items, allowed_weight, max_items); cells != want*(max_items+1) {
+				t.Errorf("%s: cardinality dynamic programming computed %d cells, want %d", name, cells, want*(max_items+1))
+			}
+		}
+	}
+}
+
+// Each case has a single optimal selection, which the walk back
+// through took_array must rebuild exactly.
+func TestDynamicProgrammingReconstruction(t *testing.T) {
+	cases := []struct {
+		name           string
+		values         []int
+		weights        []int
+		allowed_weight int
+		want           []int
+	}{
+		{"item weighs the whole capacity", []int{9, 4, 4}, []int{10, 5, 6}, 10, []int{0}},
+		{"item 0 must be selected", []int{10, 1, 2}, []int{3, 3, 4}, 7, []int{0, 2}},
+		{"item 0 must not be selected", []int{3, 4, 4}, []int{5, 3, 2}, 5, []int{1, 2}},
+		{"last item must be selected", []int{1, 2, 9}, []int{2, 2, 4}, 4, []int{2}},
+		{"zero-weight item", []int{2, 5, 3}, []int{0, 4, 4}, 4, []int{0, 1}},
+		{"zero-weight item, zero capacity", []int{2, 5}, []int{0, 1}, 0, []int{0}},
+		{"one item that fits", []int{7}, []int{3}, 3, []int{0}},
+		{"one item that doesn't fit", []int{7}, []int{3}, 2, []int{}},
+		{"everything fits", []int{1, 2, 3}, []int{1, 1, 1}, 3, []int{0, 1, 2}},
+	}
+	for _, c := range cases {
+		solution, _, _ := dynamic_programming(items_of(c.values, c.weights), c.allowed_weight)
+		if got := selected_positions(solution); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: selected %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+// Count the selections worth the optimum. best[w] is the best value of
+// a selection that weighs exactly w and count[w] how many selections
+// have it, so no selection is counted twice.
+func count_optimal_selections(items []Item, allowed_weight int) int {
+	best := make([]int, allowed_weight+1)
+	count := make([]int, allowed_weight+1)
+	for w := range best {
+		best[w] = -1
+	}
+	best[0], count[0] = 0, 1
+	for _, item := range items {
+		for w := allowed_weight; w >= item.weight; w-- {
+			if best[w-item.weight] < 0 {
+				continue
+			}
+			switch value := best[w-item.weight] + item.value; {
+			case value > best[w]:
+				best[w], count[w] = value, count[w-item.weight]
+			case value == best[w]:
+				count[w] += count[w-item.weight]
+			}
+		}
+	}
+	optimum, num_optimal := 0, 0
+	for w := range best {
+		switch {
+		case best[w] > optimum:
+			optimum, num_optimal = best[w], count[w]
+		case best[w] == optimum:
+			num_optimal += count[w]
+		}
+	}
+	return num_optimal
+}
+
+// Every solver must return the same selection when run twice, the
+// parallel ones included.
+func TestSolversAreDeterministic(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	items := random_items(7, 20)
+	allowed_weight := sum_weights(items, true) / 2
+	for _, s := range concurrent_solvers(items, allowed_weight, 4) {
+		first, first_value, _, _ := s.alg(items, allowed_weight)
+		second, second_value, _, _ := s.alg(items, allowed_weight)
+		if first_value != second_value || !reflect.DeepEqual(selection_of(first), selection_of(second)) {
+			t.Errorf("%s: the runs found %v (%d) and %v (%d)", s.name,
+				selected_positions(first), first_value, selected_positions(second), second_value)
+		}
+	}
+}
+
+// Permuting the items must not change the optimum the exact solvers
+// find. When only one selection is optimal, it must not change the
+// selection either, once mapped back to the original positions.
+func TestExactSolversIgnoreItemOrder(t *testing.T) {
+	num_unique := 0
+	for seed := int64(1); seed <= 30; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		items := random_items(seed, 14)
+		allowed_weight := sum_weights(items, true) / 2
+		unique := count_optimal_selections(items, allowed_weight) == 1
+		if unique {
+			num_unique++
+		}
+
+		perm := random.Perm(len(items))
+		permuted := make([]Item, len(items))
+		for k, i := range perm {
+			permuted[k] = items[i]
+		}
+		for _, s := range exact_solvers {
+			solution, value, _, _ := s.alg(items, allowed_weight)
+			permuted_solution, permuted_value, _, _ := s.alg(permuted, allowed_weight)
+			if permuted_value != value {
+				t.Errorf("seed %d: %s found %d on the permuted items, %d on the originals", seed, s.name, permuted_value, value)
+				continue
+			}
+			mapped := make([]bool, len(items))
+			for k, i := range perm {
+				mapped[i] = permuted_solution[k].is_selected
+			}
+			if unique && !reflect.DeepEqual(mapped, selection_of(solution)) {
+				t.Errorf("seed %d: %s selected differently on the permuted items, but the optimum is unique", seed, s.name)
+			}
+		}
+	}
+	if num_unique == 0 {
+		t.Error("no instance had a unique optimum, so no selections were compared")
+	}
+
+	// Any three of four identical items are optimal.
+	if count := count_optimal_selections(items_of([]int{4, 4, 4, 4}, []int{3, 3, 3, 3}), 10); count != 4 {
+		t.Errorf("counted %d optimal selections of identical items, want 4", count)
+	}
+}
+
+// A random instance for the property tests.
+type test_instance struct {
+	items          []Item
+	allowed_weight int
+}
+
+// Make instances of up to 12 items with values 0 to 10, weights 0 to
+// 10, and a capacity up to the total weight.
+func (test_instance) Generate(random *rand.Rand, size int) reflect.Value {
+	num_items := random.Intn(13)
+	values := make([]int, num_items)
+	weights := make([]int, num_items)
+	for i := range values {
+		values[i] = random.Intn(11)
+		weights[i] = random.Intn(11)
+	}
+	items := items_of(values, weights)
+	return reflect.ValueOf(test_instance{items, random.Intn(sum_weights(items, true) + 1)})
+}
+
+func (instance test_instance) String() string {
+	var pairs []string
+	for _, item := range instance.items {
+		pairs = append(pairs, fmt.Sprintf("(%d, %d)", item.value, item.weight))
+	}
+	return fmt.Sprintf("items %s, capacity %d", strings.Join(pairs, " "), instance.allowed_weight)
+}
+
+// Return the instance without item i.
+func (instance test_instance) without(i int) test_instance {
+	items := append(copy_items(instance.items[:i]), instance.items[i+1:]...)
+	return test_instance{items_of_items(items), instance.allowed_weight}
+}
+
+// Renumber copies of items so their ids match their new positions.
+func items_of_items(items []Item) []Item {
+	items = copy_items(items)
+	for i := range items {
+		items[i].id = i
+	}
+	return items
+}
+
+// Check a property on random instances. quick.Check doesn't shrink, so
+// on a failure we drop items and lower the capacity while the property
+// still fails, and report the smallest instance we get to.
+func check_property(t *testing.T, name string, property func(test_instance) bool) {
+	t.Helper()
+	config := &quick.Config{MaxCount: 300, Rand: rand.New(rand.NewSource(1))}
+	err := quick.Check(property, config)
+	if err == nil {
+		return
+	}
+	check_error, ok := err.(*quick.CheckError)
+	if !ok {
+		t.Fatalf("%s: %v", name, err)
+	}
+	instance := check_error.In[0].(test_instance)
+	for shrunk := true; shrunk; {
+		shrunk = false
+		for i := range instance.items {
+			if smaller := instance.without(i); !property(smaller) {
+				instance, shrunk = smaller, true
+				break
+			}
+		}
+		if smaller := (test_instance{instance.items, instance.allowed_weight - 1}); !shrunk && smaller.allowed_weight >= 0 && !property(smaller) {
+			instance, shrunk = smaller, true
+		}
+	}
+	t.Errorf("%s fails on %v", name, instance)
+}
+
+// Return the optimum of an instance, found by dynamic programming.
+func optimum_of(instance test_instance) int {
+	_, value, _ := dynamic_programming(instance.items, instance.allowed_weight)
+	return value
+}
+
+func TestSolverProperties(t *testing.T) {
+	// Every solver's solution fits and is worth what it claims.
+	for _, s := range concurrent_solvers(nil, 0, 2) {
+		check_property(t, s.name+" returns a feasible solution worth its value", func(instance test_instance) bool {
+			solution, value, _, _ := s.alg(instance.items, instance.allowed_weight)
+			return verify_solution(instance.items, solution, value, instance.allowed_weight, nil) == nil
+		})
+	}
+
+	for _, s := range exact_solvers {
+		solve := func(instance test_instance) int {
+			_, value, _, _ := s.alg(instance.items, instance.allowed_weight)
+			return value
+		}
+		check_property(t, s.name+" finds the optimum", func(instance test_instance) bool {
+			return solve(instance) == optimum_of(instance)
+		})
+		check_property(t, s.name+": adding an item never lowers the optimum", func(instance test_instance) bool {
+			bigger := test_instance{items_of_items(append(copy_items(instance.items), items_of([]int{5}, []int{3})...)), instance.allowed_weight}
+			return solve(bigger) >= solve(instance)
+		})
+		check_property(t, s.name+": more capacity never lowers the optimum", func(instance test_instance) bool {
+			return solve(test_instance{instance.items, instance.allowed_weight + 1}) >= solve(instance)
+		})
+		check_property(t, s.name+": removing an unselected item keeps the optimum", func(instance test_instance) bool {
+			solution, value, _, _ := s.alg(instance.items, instance.allowed_weight)
+			for i := range solution {
+				if !solution[i].is_selected && solve(instance.without(i)) != value {
+					return false
+				}
+			}
+			return true
+		})
+	}
+}
+
+// An instance of the regression corpus in testdata/corpus. The optima
+// of the published instances come from their source, and those of the
+// others from trying every subset in make_corpus.py, so neither relies
+// on the solvers here. The fields are exported for encoding/json.
+type corpus_instance struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Capacity int    `json:"capacity"`
+	Values   []int  `json:"values"`
+	Weights  []int  `json:"weights"`
+	Optimum  int    `json:"optimum"`
+}
+
+// Load every instance in testdata/corpus.
+func load_corpus(tb testing.TB) []corpus_instance {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "corpus", "*.json"))
+	if err != nil || len(paths) == 0 {
+		tb.Fatalf("no corpus instances found: %v", err)
+	}
+	corpus := make([]corpus_instance, len(paths))
+	for k, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := json.Unmarshal(data, &corpus[k]); err != nil {
+			tb.Fatalf("%s: %v", path, err)
+		}
+		if len(corpus[k].Values) != len(corpus[k].Weights) {
+			tb.Fatalf("%s: %d values but %d weights", path, len(corpus[k].Values), len(corpus[k].Weights))
+		}
+	}
+	return corpus
+}
+
+// Every exact solver must find each corpus instance's optimum, with a
+// solution that checks out. Each instance is small enough for all of
+// them.
+func TestCorpus(t *testing.T) {
+	for _, instance := range load_corpus(t) {
+		items := items_of(instance.Values, instance.Weights)
+		check_exact_solvers(t, instance.Name, items, instance.Capacity, instance.Optimum)
+		others := map[string]func() ([]Item, int){
+			"value dynamic programming": func() ([]Item, int) {
+				solution, value, _ := value_dynamic_programming(items, instance.Capacity)
+				return solution, value
+			},
+			"parallel exhaustive search": func() ([]Item, int) {
+				solution, value, _ := parallel_exhaustive_search(items, instance.Capacity, 4)
+				return solution, value
+			},
+			"parallel Rod's technique": func() ([]Item, int) {
+				solution, value, _, _ := parallel_rods_technique(items, instance.Capacity, 4)
+				return solution, value
+			},
+			"auto_exact": func() ([]Item, int) {
+				solution, value, _, _ := auto_exact(items, instance.Capacity)
+				return solution, value
+			},
+		}
+		for name, alg := range others {
+			solution, value := alg()
+			if value != instance.Optimum {
+				t.Errorf("%s: %s found value %d, want %d", instance.Name, name, value, instance.Optimum)
+			}
+			if err := verify_solution(items, solution, value, instance.Capacity, nil); err != nil {
+				t.Errorf("%s: %s: %v", instance.Name, name, err)
+			}
+		}
+	}
+}
+
+// A case from testdata/reference, whose answer reference.py found by
+// trying every selection. Quantities are only set for the bounded
+// knapsack and groups only for the multiple-choice one. The bounded
+// cases leave out feasible, since taking nothing always fits.
+type reference_case struct {
+	Capacity   int   `json:"capacity"`
+	Values     []int `json:"values"`
+	Weights    []int `json:"weights"`
+	Quantities []int `json:"quantities"`
+	Groups     []int `json:"groups"`
+	Feasible   bool  `json:"feasible"`
+	Optimum    int   `json:"optimum"`
+}
+
+// Load the reference cases of one variant.
+func load_reference(t *testing.T, variant string) []reference_case {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "reference", variant+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cases []reference_case
+	if err := json.Unmarshal(data, &cases); err != nil {
+		t.Fatalf("%s: %v", variant, err)
+	}
+	if len(cases) < 20 {
+		t.Fatalf("%s: only %d reference cases", variant, len(cases))
+	}
+	return cases
+}
+
+// The bounded, multiple-choice and exact-weight solvers must match the
+// answers of the reference script, which shares no code with them.
+func TestReference(t *testing.T) {
+	for k, c := range load_reference(t, "bounded") {
+		name := fmt.Sprintf("bounded case %d", k)
+		items := items_of(c.Values, c.Weights)
+		for i := range items {
+			items[i].quantity = c.Quantities[i]
+		}
+		solution, value, _ := bounded_branch_and_bound(items, c.Capacity)
+		check_against_brute_force(t, name+": branch and bound", items, solution, value, c.Optimum,
+			within_counts(c.Quantities, c.Capacity), selected_value)
+		solution, value, _ = bounded_dynamic_programming(items, c.Capacity)
+		check_against_brute_force(t, name+": dynamic programming", items, solution, value, c.Optimum,
+			within_counts(c.Quantities, c.Capacity), selected_value)
+	}
+
+	for k, c := range load_reference(t, "multiple_choice") {
+		name := fmt.Sprintf("multiple-choice case %d", k)
+		items := items_of(c.Values, c.Weights)
+		for i := range items {
+			items[i].group = c.Groups[i]
+		}
+		one_per_group := func(selection []Item) bool {
+			counts := make([]int, len(group_members(items)))
+			for _, item := range selection {
+				if item.is_selected {
+					counts[item.group]++
+				}
+			}
+			for _, count := range counts {
+				if count != 1 {
+					return false
+				}
+			}
+			return sum_weights(selection, false) <= c.Capacity
+		}
+		solution, value, _, feasible := multiple_choice_dynamic_programming(items, c.Capacity)
+		if feasible != c.Feasible {
+			t.Errorf("%s: feasible = %v, want %v", name, feasible, c.Feasible)
+		} else if feasible {
+			check_against_brute_force(t, name, items, solution, value, c.Optimum, one_per_group, selected_value)
+		}
+	}
+
+	for k, c := range load_reference(t, "exact_weight") {
+		name := fmt.Sprintf("exact-weight case %d", k)
+		items := items_of(c.Values, c.Weights)
+		exact := func(selection []Item) bool {
+			return sum_weights(selection, false) == c.Capacity
+		}
+		for _, s := range []struct {
+			name string
+			alg  func([]Item, int) ([]Item, int, int, bool)
+		}{
+			{"dynamic programming", exact_weight_dynamic_programming},
+			{"branch and bound", exact_weight_branch_and_bound},
+		} {
+			solution, value, _, reachable := s.alg(items, c.Capacity)
+			if reachable != c.Feasible {
+				t.Errorf("%s: %s: reachable = %v, want %v", name, s.name, reachable, c.Feasible)
+			} else if reachable {
+				check_against_brute_force(t, name+": "+s.name, items, solution, value, c.Optimum, exact, selected_value)
+			}
+		}
+	}
+}
+
+// Encode an instance as a fuzz input for decode_instance, if it fits:
+// a capacity below 256, at most 16 items, and values and weights below
+// 32.
+func encode_instance(instance corpus_instance) ([]byte, bool) {
+	if instance.Capacity < 0 || instance.Capacity > 255 || len(instance.Values) > 16 {
+		return nil, false
+	}
+	data := []byte{byte(instance.Capacity)}
+	for i := range instance.Values {
+		if instance.Values[i] < 0 || instance.Values[i] > 31 || instance.Weights[i] < 0 || instance.Weights[i] > 31 {
+			return nil, false
+		}
+		data = append(data, byte(instance.Values[i]), byte(instance.Weights[i]))
+	}
+	return data, true
+}
+
+// Decode a fuzz input: the first byte is the capacity, and each pair of
+// bytes after it an item's value and weight, each below 32. At most 16
+// items are used.
+func decode_instance(data []byte) test_instance {
+	if len(data) == 0 {
+		return test_instance{items_of(nil, nil), 0}
+	}
+	var values, weights []int
+	for k := 1; k+1 < len(data) && len(values) < 16; k += 2 {
+		values = append(values, int(data[k]%32))
+		weights = append(weights, int(data[k+1]%32))
+	}
+	return test_instance{items_of(values, weights), int(data[0])}
+}
+
+// Dynamic programming and branch and bound must find the same optimum,
+// with solutions that check out. The corpus instances that fit the
+// encoding are seeds too. Run the fuzzer with
+//
+//	go test -run XXX -fuzz FuzzDynamicProgramming main.go main_test.go
+//
+// and turn any input it finds into a test case.
+func FuzzDynamicProgramming(f *testing.F) {
+	f.Add([]byte{10, 5, 4, 5, 4, 5, 4})        // Duplicates.
+	f.Add([]byte{0, 3, 0, 7, 0, 2, 1})         // Zero weights at zero capacity.
+	f.Add([]byte{12, 6, 4, 6, 4, 9, 12, 1, 1}) // An item that weighs the whole capacity.
+	f.Add([]byte{7, 4, 3, 3, 4, 5, 4, 2, 3})   // Tight capacity.
+	f.Add([]byte{1})                           // No items.
+	for _, instance := range load_corpus(f) {
+		if data, ok := encode_instance(instance); ok {
+			f.Add(data)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		instance := decode_instance(data)
+		dp_solution, dp_value, _ := dynamic_programming(instance.items, instance.allowed_weight)
+		bb_solution, bb_value, _, _ := branch_and_bound(instance.items, instance.allowed_weight)
+		if dp_value != bb_value {
+			t.Fatalf("%v: dynamic programming found %d, branch and bound %d", instance, dp_value, bb_value)
+		}
+		if err := verify_solution(instance.items, dp_solution, dp_value, instance.allowed_weight, nil); err != nil {
+			t.Fatalf("%v: dynamic programming: %v", instance, err)
+		}
+		if err := verify_solution(instance.items, bb_solution, bb_value, instance.allowed_weight, nil); err != nil {
+			t.Fatalf("%v: branch and bound: %v", instance, err)
+		}
+	})
+}
+
+// reachable_weights must agree with a plain []bool table of the
+// weights some selection adds up to. The first byte times 4 is the
+// capacity, and each byte after it an item's weight, so that the shifts
+// cross word boundaries and the capacity ends anywhere in a word. At
+// most 16 items are used. Run the fuzzer with
+//
+//	go test -run XXX -fuzz FuzzReachableWeights main.go main_test.go
+func FuzzReachableWeights(f *testing.F) {
+	f.Add([]byte{16, 64, 1})          // A shift of exactly one word.
+	f.Add([]byte{40, 63, 65, 128, 0}) // Shifts either side of a word, two words, and zero.
+	f.Add([]byte{0, 1, 2})            // Only weight 0 fits.
+	f.Add([]byte{255, 255, 255, 255}) // Heavy items in a long row.
+	f.Add([]byte{5})                  // No items.
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) == 0 {
+			return
+		}
+		max_weight := int(data[0]) * 4
+		var weights []int
+		for _, b := range data[1:min(len(data), 17)] {
+			weights = append(weights, int(b))
+		}
+		items := items_of(make([]int, len(weights)), weights)
+
+		want := make([]bool, max_weight+1)
+		want[0] = true
+		for _, weight := range weights {
+			for w := max_weight; w >= weight; w-- {
+				want[w] = want[w] || want[w-weight]
+			}
+		}
+		reachable := reachable_weights(items, max_weight)
+		if len(reachable) != max_weight/64+1 {
+			t.Fatalf("capacity %d, weights %v: %d words", max_weight, weights, len(reachable))
+		}
+		for w := range want {
+			if is_reachable(reachable, w) != want[w] {
+				t.Fatalf("capacity %d, weights %v: weight %d reachable %v, want %v",
+					max_weight, weights, w, is_reachable(reachable, w), want[w])
+			}
+		}
+		if past := reachable[len(reachable)-1] >> uint(max_weight%64) >> 1; past != 0 {
+			t.Fatalf("capacity %d, weights %v: bits set past the capacity", max_weight, weights)
+		}
+	})
+}
+
+// Benchmark a solver on the demo's kind of items, with the capacity at
+// half their total weight. The items are made outside the timed loop,
+// and the solvers work on their own copies. Compare runs with
+// benchstat:
+//
+//	go test -run XXX -bench . -count 10 main.go main_test.go > old.txt
+//	(change something)
+//	go test -run XXX -bench . -count 10 main.go main_test.go > new.txt
+//	benchstat old.txt new.txt
+func benchmark_solver(b *testing.B, alg solver, sizes ...int) {
+	for _, num_items := range sizes {
+		items := make_items(num_items, min_value, max_value, min_weight, max_weight)
+		allowed_weight := sum_weights(items, true) / 2
+		b.Run(fmt.Sprintf("n=%d", num_items), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				alg(items, allowed_weight)
+			}
+		})
+	}
+}
+
+func BenchmarkExhaustiveSearch(b *testing.B) {
+	benchmark_solver(b, no_stats(exhaustive_search), 20)
+}
+
+func BenchmarkBranchAndBound(b *testing.B) {
+	benchmark_solver(b, branch_and_bound, 30, 40)
+}
+
+// Rod's technique without sorting takes minutes at 100 items, so we
+// stop at max_rods_items.
+func BenchmarkRodsTechnique(b *testing.B) {
+	benchmark_solver(b, rods_technique, 40, max_rods_items)
+}
+
+func BenchmarkRodsTechniqueSorted(b *testing.B) {
+	benchmark_solver(b, rods_technique_sorted, 40, 100, 200)
+}
+
+func BenchmarkParallelRodsTechnique(b *testing.B) {
+	items := make_items(300, min_value, max_value, min_weight, max_weight)
+	allowed_weight := sum_weights(items, true) / 2
+	b.ReportAllocs()
+	for b.Loop() {
+		parallel_rods_technique(items, allowed_weight, 8)
+	}
+}
+
+// Dynamic programming on 1000 items with weights up to 200, so both
+// capacities bind. At 100,000 the weight table would pass max_dp_cells,
+// so it indexes by value instead.
+func BenchmarkDynamicProgramming(b *testing.B) {
+	items := make_items(1000, min_value, max_value, min_weight, 200)
+	for _, allowed_weight := range []int{10_000, 100_000} {
+		b.Run(fmt.Sprintf("W=%d", allowed_weight), func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				dynamic_programming(items, allowed_weight)
+			}
+		})
+	}
+}
+
+// Branch and bound on each corpus instance.
+func BenchmarkCorpus(b *testing.B) {
+	for _, instance := range load_corpus(b) {
+		items := items_of(instance.Values, instance.Weights)
+		b.Run(instance.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				branch_and_bound(items, instance.Capacity)
+			}
+		})
+	}
+}
+
+// The reachability bitset of 100 items with weights up to 10,000 at a
+// capacity of 1,000,000, where each item shifts a row of 15,626 words.
+func BenchmarkReachableWeights(b *testing.B) {
+	items := make_items(100, min_value, max_value, 1, 10_000)
+	b.ReportAllocs()
+	for b.Loop() {
+		reachable_weights(items, 1_000_000)
+	}
+}
+
+// run must exit with 2 on a bad flag and 0 on -h, printing only the
+// error and usage to stderr. Valid flags must run the demo and exit
+// with 0, clamping a worker count out of range and saying so. The full
+// runs take a second each, so -short skips them.
+func TestRunFlags(t *testing.T) {
+	cases := []struct {
+		args        []string
+		status      int
+		full        bool
+		want_stdout string
+		want_stderr string
+	}{
+		{[]string{"-bogus"}, 2, false, "", "flag provided but not defined: -bogus"},
+		{[]string{"-workers", "many"}, 2, false, "", `invalid value "many" for flag -workers`},
+		{[]string{"-concurrent=maybe"}, 2, false, "", `invalid boolean value "maybe" for -concurrent`},
+		{[]string{"-h"}, 0, false, "", "Usage of knapsack"},
+		{[]string{"-workers", "0", "-concurrent"}, 0, true, "-workers 0 is less than 1, using 1 worker", ""},
+		{[]string{"-concurrent", "-workers", "1000000"}, 0, true, "-workers 1000000 is more than", ""},
+	}
+	for _, c := range cases {
+		if c.full && testing.Short() {
+			continue
+		}
+		var status int
+		var stdout string
+		stderr := capture_stderr(t, func() {
+			stdout = capture_stdout(t, func() { status = run(c.args) })
+		})
+		if status != c.status {
+			t.Errorf("%v: exit status %d, want %d", c.args, status, c.status)
+		}
+		if c.want_stdout == "" && stdout != "" {
+			t.Errorf("%v: printed %q to stdout, want nothing", c.args, stdout)
+		}
+		if !strings.Contains(stdout, c.want_stdout) {
+			t.Errorf("%v: stdout doesn't contain %q", c.args, c.want_stdout)
+		}
+		if c.want_stderr == "" && stderr != "" {
+			t.Errorf("%v: printed %q to stderr, want nothing", c.args, stderr)
+		}
+		if !strings.Contains(stderr, c.want_stderr) {
+			t.Errorf("%v: stderr %q doesn't contain %q", c.args, stderr, c.want_stderr)
+		}
+		if c.full && !strings.Contains(stdout, "*** Comparison ***") {
+			t.Errorf("%v: no comparison in the output", c.args)
+		}
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// Drop the times from the output, since they change from run to run.
+func normalize_output(output string) string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "Elapsed: ") {
+			lines = append(lines, incumbent_time.ReplaceAllString(line, " at Ts"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var incumbent_time = regexp.MustCompile(` at [0-9.]+s`)
+
+// The demo's output, without the times, must match testdata/main.golden.
+// One worker keeps the parallel algorithms' counts deterministic. After
+// an intended change, rewrite the golden file with
+//
+//	go test -run Golden main.go main_test.go -update
+func TestGoldenOutput(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the demo takes a few seconds")
+	}
+	var status int
+	got := normalize_output(capture_stdout(t, func() { status = run([]string{"-workers", "1"}) }))
+	if status != 0 {
+		t.Errorf("exit status %d", status)
+	}
+
+	golden := filepath.Join("testdata", "main.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		got_lines, want_lines := strings.Split(got, "\n"), strings.Split(string(want), "\n")
+		for i := 0; i < len(got_lines) && i < len(want_lines); i++ {
+			if got_lines[i] != want_lines[i] {
+				t.Fatalf("output differs from %s at line %d:\ngot:  %s\nwant: %s", golden, i+1, got_lines[i], want_lines[i])
+			}
+		}
+		t.Fatalf("output has %d lines, %s has %d", len(got_lines), golden, len(want_lines))
+	}
+}
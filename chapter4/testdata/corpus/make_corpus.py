@@ -0,0 +1,97 @@
+#!/usr/bin/env python3
+"""Write the generated instances of the regression corpus.
+
+Each instance is solved by trying every subset of its items, independently
+of the Go solvers, and written to a JSON file next to this script. The
+published instances in the corpus were entered by hand and are left alone.
+
+    python3 make_corpus.py
+"""
+
+import json
+import os
+import random
+
+R = 30  # Weights, and most values, are drawn from 1 to R.
+
+
+def uncorrelated(rng, n):
+    weights = [rng.randint(1, R) for _ in range(n)]
+    return [rng.randint(1, R) for _ in range(n)], weights
+
+
+def weakly_correlated(rng, n):
+    weights = [rng.randint(1, R) for _ in range(n)]
+    return [max(1, w + rng.randint(-R // 10, R // 10)) for w in weights], weights
+
+
+def strongly_correlated(rng, n):
+    weights = [rng.randint(1, R) for _ in range(n)]
+    return [w + R // 10 for w in weights], weights
+
+
+def inverse_strongly_correlated(rng, n):
+    values = [rng.randint(1, R) for _ in range(n)]
+    return values, [v + R // 10 for v in values]
+
+
+def subset_sum(rng, n):
+    weights = [rng.randint(1, R) for _ in range(n)]
+    return list(weights), weights
+
+
+CLASSES = [
+    ("uncorrelated", uncorrelated),
+    ("weakly_correlated", weakly_correlated),
+    ("strongly_correlated", strongly_correlated),
+    ("inverse_strongly_correlated", inverse_strongly_correlated),
+    ("subset_sum", subset_sum),
+]
+
+
+def optimum(values, weights, capacity):
+    """Return the best value of any subset that fits, trying them all."""
+    best = 0
+    n = len(values)
+    for subset in range(1 << n):
+        value = weight = 0
+        for i in range(n):
+            if subset >> i & 1:
+                value += values[i]
+                weight += weights[i]
+        if weight <= capacity and value > best:
+            best = value
+    return best
+
+
+def write(name, source, values, weights, capacity):
+    fields = [
+        ("name", name),
+        ("source", source),
+        ("capacity", capacity),
+        ("values", values),
+        ("weights", weights),
+        ("optimum", optimum(values, weights, capacity)),
+    ]
+    # One field per line, with the lists on one line each.
+    lines = ["\t%s: %s" % (json.dumps(key), json.dumps(value)) for key, value in fields]
+    path = os.path.join(os.path.dirname(os.path.abspath(__file__)), name + ".json")
+    with open(path, "w") as f:
+        f.write("{\n" + ",\n".join(lines) + "\n}\n")
+
+
+def main():
+    for k, (class_name, make) in enumerate(CLASSES):
+        for n in (5, 9, 13, 17):
+            rng = random.Random(1000 * k + n)
+            values, weights = make(rng, n)
+            write("%s_%d" % (class_name, n), "make_corpus.py, exhaustive", values, weights, sum(weights) // 2)
+
+    # Edge cases the random classes rarely hit.
+    write("zero_weights", "make_corpus.py, exhaustive", [3, 0, 7, 2, 5], [0, 0, 4, 0, 6], 4)
+    write("identical_items", "make_corpus.py, exhaustive", [6] * 9, [4] * 9, 17)
+    write("nothing_fits", "make_corpus.py, exhaustive", [9, 8, 7], [5, 6, 7], 4)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,137 @@
+#!/usr/bin/env python3
+"""Write reference answers for three knapsack variants.
+
+Each answer comes from trying every possible selection, written as plainly
+as possible, so it is derived independently of the Go solvers. The cases
+and their answers go to one JSON file per variant next to this script:
+
+    bounded.json          each item can be taken up to its quantity times
+    multiple_choice.json  exactly one item from each group
+    exact_weight.json     the selection must weigh exactly the capacity
+
+Regenerate them with
+
+    python3 reference.py
+"""
+
+import itertools
+import json
+import os
+import random
+
+NUM_CASES = 24  # Cases per variant.
+
+
+def bounded(values, weights, quantities, capacity):
+    """Return the best value of any counts that fit, each count at most
+    its item's quantity."""
+    best = 0
+    for counts in itertools.product(*[range(q + 1) for q in quantities]):
+        weight = sum(c * w for c, w in zip(counts, weights))
+        value = sum(c * v for c, v in zip(counts, values))
+        if weight <= capacity:
+            best = max(best, value)
+    return best
+
+
+def multiple_choice(values, weights, groups, capacity):
+    """Return the best value of one item from each group that fits, or
+    None if no choice fits."""
+    members = [[i for i, g in enumerate(groups) if g == group] for group in range(max(groups) + 1)]
+    best = None
+    for choice in itertools.product(*members):
+        weight = sum(weights[i] for i in choice)
+        value = sum(values[i] for i in choice)
+        if weight <= capacity and (best is None or value > best):
+            best = value
+    return best
+
+
+def exact_weight(values, weights, capacity):
+    """Return the best value of any selection that weighs exactly the
+    capacity, or None if none does."""
+    best = None
+    for selected in itertools.product([False, True], repeat=len(values)):
+        weight = sum(w for s, w in zip(selected, weights) if s)
+        value = sum(v for s, v in zip(selected, values) if s)
+        if weight == capacity and (best is None or value > best):
+            best = value
+    return best
+
+
+def bounded_cases(rng):
+    cases = []
+    for k in range(NUM_CASES):
+        n = k % 6 + 1
+        values = [rng.randint(0, 20) for _ in range(n)]
+        weights = [rng.randint(1, 10) for _ in range(n)]
+        quantities = [rng.randint(0, 4) for _ in range(n)]
+        capacity = rng.randint(0, sum(q * w for q, w in zip(quantities, weights)) + 2)
+        cases.append({
+            "capacity": capacity,
+            "values": values,
+            "weights": weights,
+            "quantities": quantities,
+            "optimum": bounded(values, weights, quantities, capacity),
+        })
+    return cases
+
+
+def multiple_choice_cases(rng):
+    cases = []
+    for k in range(NUM_CASES):
+        num_groups = k % 4 + 1
+        n = num_groups + rng.randint(0, 6)
+        # Every group gets at least one item.
+        groups = list(range(num_groups)) + [rng.randrange(num_groups) for _ in range(n - num_groups)]
+        rng.shuffle(groups)
+        values = [rng.randint(0, 20) for _ in range(n)]
+        weights = [rng.randint(0, 10) for _ in range(n)]
+        capacity = rng.randint(0, 6 * num_groups)
+        best = multiple_choice(values, weights, groups, capacity)
+        cases.append({
+            "capacity": capacity,
+            "values": values,
+            "weights": weights,
+            "groups": groups,
+            "feasible": best is not None,
+            "optimum": best or 0,
+        })
+    return cases
+
+
+def exact_weight_cases(rng):
+    cases = []
+    for k in range(NUM_CASES):
+        n = k % 10 + 1
+        values = [rng.randint(0, 20) for _ in range(n)]
+        weights = [rng.randint(0, 12) for _ in range(n)]
+        capacity = rng.randint(0, sum(weights) + 1)
+        best = exact_weight(values, weights, capacity)
+        cases.append({
+            "capacity": capacity,
+            "values": values,
+            "weights": weights,
+            "feasible": best is not None,
+            "optimum": best or 0,
+        })
+    return cases
+
+
+def write(name, cases):
+    # One case per line keeps the diffs readable.
+    lines = ["\t" + json.dumps(case) for case in cases]
+    path = os.path.join(os.path.dirname(os.path.abspath(__file__)), name + ".json")
+    with open(path, "w") as f:
+        f.write("[\n" + ",\n".join(lines) + "\n]\n")
+
+
+def main():
+    rng = random.Random(197)
+    write("bounded", bounded_cases(rng))
+    write("multiple_choice", multiple_choice_cases(rng))
+    write("exact_weight", exact_weight_cases(rng))
+
+
+if __name__ == "__main__":
+    main()